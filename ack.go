@@ -0,0 +1,153 @@
+package bayeux
+
+import (
+	"sync"
+
+	"github.com/ebittleman/go-bayeux/channel"
+	"github.com/ebittleman/go-bayeux/messages"
+)
+
+type ackExtension struct{}
+
+type unackedMessage struct {
+	batch int
+	msg   messages.Message
+}
+
+type ackSession struct {
+	batch   int
+	unacked []unackedMessage
+	lock    *sync.Mutex
+}
+
+// NewAckExtension implements the server side of the acknowledge extension.
+// Clients that send {"ext": {"ack": true}} with their handshake have every
+// message kept until a later /meta/connect acknowledges the batch it was
+// delivered in. Messages from batches that were never acknowledged are
+// delivered again when the client reconnects.
+func NewAckExtension() ServerExtension {
+	return &ackExtension{}
+}
+
+func (e *ackExtension) Incoming(client Client, msg map[string]interface{}) bool {
+	if msg["channel"] != "/meta/handshake" {
+		return true
+	}
+
+	ext, _ := msg["ext"].(map[string]interface{})
+	if enabled, _ := ext["ack"].(bool); enabled {
+		client.AddExtension(newAckSession())
+	}
+
+	return true
+}
+
+func (e *ackExtension) Outgoing(client Client, msg map[string]interface{}) bool {
+	return true
+}
+
+func (e *ackExtension) OutgoingEncoded(client Client, msg messages.Encoded) bool {
+	return true
+}
+
+func newAckSession() *ackSession {
+	return &ackSession{0, make([]unackedMessage, 0), &sync.Mutex{}}
+}
+
+// OutgoingEncoded records a broadcast under the current batch. Broadcasts
+// are never meta messages.
+func (s *ackSession) OutgoingEncoded(client Client, msg messages.Encoded) bool {
+	s.lock.Lock()
+	s.unacked = append(s.unacked, unackedMessage{s.batch, msg})
+	s.lock.Unlock()
+
+	return true
+}
+
+// prune forgets messages from batches before the one being closed. The
+// connect this reply answers has already acknowledged or redelivered them,
+// so they are only left over when the client sent no ack id at all.
+func (s *ackSession) prune() {
+	pending := s.unacked[:0]
+	for _, unacked := range s.unacked {
+		if unacked.batch >= s.batch {
+			pending = append(pending, unacked)
+		}
+	}
+
+	for i := len(pending); i < len(s.unacked); i++ {
+		s.unacked[i] = unackedMessage{}
+	}
+	s.unacked = pending
+}
+
+// Incoming drops the messages acknowledged by a /meta/connect and delivers
+// the ones from earlier batches again.
+func (s *ackSession) Incoming(client Client, msg map[string]interface{}) bool {
+	if msg["channel"] != "/meta/connect" {
+		return true
+	}
+
+	ext, _ := msg["ext"].(map[string]interface{})
+	ack, ok := ext["ack"].(float64)
+	if !ok {
+		return true
+	}
+
+	s.lock.Lock()
+	pending := make([]unackedMessage, 0, len(s.unacked))
+	redeliver := make([]messages.Message, 0)
+	for _, unacked := range s.unacked {
+		if unacked.batch <= int(ack) {
+			continue
+		}
+		if unacked.batch < s.batch {
+			redeliver = append(redeliver, unacked.msg)
+			continue
+		}
+		pending = append(pending, unacked)
+	}
+	s.unacked = pending
+	s.lock.Unlock()
+
+	for _, msg := range redeliver {
+		client.SendMessage(msg)
+	}
+
+	return true
+}
+
+// Outgoing records messages under the current batch, which is closed by
+// stamping its id on the next /meta/connect reply.
+func (s *ackSession) Outgoing(client Client, msg map[string]interface{}) bool {
+	name, _ := msg["channel"].(string)
+
+	switch {
+	case name == "/meta/handshake":
+		if successful, _ := msg["successful"].(bool); successful {
+			ext, _ := msg["ext"].(map[string]interface{})
+			if ext == nil {
+				ext = make(map[string]interface{})
+				msg["ext"] = ext
+			}
+			ext["ack"] = true
+		}
+	case name == "/meta/connect":
+		s.lock.Lock()
+		ext, _ := msg["ext"].(map[string]interface{})
+		if ext == nil {
+			ext = make(map[string]interface{})
+			msg["ext"] = ext
+		}
+		ext["ack"] = s.batch
+		s.prune()
+		s.batch++
+		s.lock.Unlock()
+	case !channel.IsMeta(name):
+		s.lock.Lock()
+		s.unacked = append(s.unacked, unackedMessage{s.batch, msg})
+		s.lock.Unlock()
+	}
+
+	return true
+}
@@ -0,0 +1,129 @@
+package bayeux
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/ebittleman/go-bayeux/messages"
+)
+
+func TestAckExtensionRedeliversUnacknowledged(t *testing.T) {
+	server := Handler(WithExtension(NewAckExtension()))
+	defer server.Close()
+
+	replies := postMessages(t, server, []map[string]interface{}{
+		{"channel": "/meta/handshake", "version": "1.0", "supportedConnectionTypes": []string{CLIENT_LONGPOLL}, "ext": map[string]interface{}{"ack": true}},
+	})
+	if ext, _ := replies[0]["ext"].(map[string]interface{}); ext["ack"] != true {
+		t.Fatalf("Ack Support Not Advertised: %v", replies)
+	}
+	clientId, _ := replies[0]["clientId"].(string)
+
+	connect := func(ack int) ([]map[string]interface{}, float64) {
+		replies := postMessages(t, server, []map[string]interface{}{
+			{"channel": "/meta/connect", "clientId": clientId, "connectionType": CLIENT_LONGPOLL, "advice": map[string]int{"timeout": 0}, "ext": map[string]interface{}{"ack": ack}},
+		})
+
+		last := replies[len(replies)-1]
+		ext, _ := last["ext"].(map[string]interface{})
+		batch, ok := ext["ack"].(float64)
+		if last["channel"] != "/meta/connect" || !ok {
+			t.Fatalf("Connect Reply Missing Ack Id: %v", replies)
+		}
+
+		return replies[:len(replies)-1], batch
+	}
+
+	_, batch := connect(-1)
+	server.Deliver(clientId, map[string]interface{}{"channel": "/chat", "data": "hello"})
+
+	delivered, next := connect(int(batch))
+	if len(delivered) != 1 || next != batch+1 {
+		t.Fatalf("Expected Message In Batch %v, got %v", next, delivered)
+	}
+
+	// The reply carrying the message was lost, so the client acks the
+	// previous batch again.
+	redelivered, last := connect(int(batch))
+	if len(redelivered) != 1 || redelivered[0]["data"] != "hello" {
+		t.Fatalf("Unacknowledged Message Not Redelivered: %v", redelivered)
+	}
+
+	if delivered, _ := connect(int(last)); len(delivered) != 0 {
+		t.Errorf("Acknowledged Message Redelivered: %v", delivered)
+	}
+}
+
+func TestAckExtensionRequiresClientSupport(t *testing.T) {
+	server := Handler(WithExtension(NewAckExtension()))
+	defer server.Close()
+
+	replies := postMessages(t, server, []map[string]interface{}{
+		{"channel": "/meta/handshake", "version": "1.0", "supportedConnectionTypes": []string{CLIENT_LONGPOLL}},
+	})
+	if _, ok := replies[0]["ext"]; ok {
+		t.Errorf("Ack Support Advertised To Client Without It: %v", replies)
+	}
+}
+
+func TestAckExtensionForgetsUnacknowledgedBatches(t *testing.T) {
+	server := Handler(WithExtension(NewAckExtension()))
+	defer server.Close()
+
+	replies := postMessages(t, server, []map[string]interface{}{
+		{"channel": "/meta/handshake", "version": "1.0", "supportedConnectionTypes": []string{CLIENT_LONGPOLL}, "ext": map[string]interface{}{"ack": true}},
+	})
+	clientId, _ := replies[0]["clientId"].(string)
+	session := server.GetClient(clientId).GetExtensions()[0].(*ackSession)
+
+	// The client never acknowledges anything.
+	for i := 0; i < 10; i++ {
+		server.Deliver(clientId, map[string]interface{}{"channel": "/chat", "data": i})
+		postMessages(t, server, []map[string]interface{}{
+			{"channel": "/meta/connect", "clientId": clientId, "connectionType": CLIENT_LONGPOLL, "advice": map[string]int{"timeout": 0}},
+		})
+	}
+
+	session.lock.Lock()
+	defer session.lock.Unlock()
+	if len(session.unacked) > 1 {
+		t.Errorf("Unacknowledged Messages Kept Growing: %d", len(session.unacked))
+	}
+}
+
+func TestAckExtensionBatchMatchesResponse(t *testing.T) {
+	server := Handler(WithExtension(NewAckExtension()))
+	defer server.Close()
+	bs := server.(*bayeuxServer)
+
+	replies := postMessages(t, server, []map[string]interface{}{
+		{"channel": "/meta/handshake", "version": "1.0", "supportedConnectionTypes": []string{CLIENT_LONGPOLL}, "ext": map[string]interface{}{"ack": true}},
+	})
+	clientId, _ := replies[0]["clientId"].(string)
+	client := server.GetClient(clientId).(*longPollClient)
+
+	// Connect is answered, then a message is published before the request
+	// holding the connect flushes its response.
+	connect := func(ack int) []interface{} {
+		payload, _ := json.Marshal(map[string]interface{}{
+			"channel": "/meta/connect", "clientId": clientId, "connectionType": CLIENT_LONGPOLL,
+			"advice": map[string]int{"timeout": 0}, "ext": map[string]interface{}{"ack": ack},
+		})
+		RouteIncomingMsg(bs, messages.RawMessage{"/meta/connect", clientId, payload})
+		server.Deliver(clientId, map[string]interface{}{"channel": "/chat", "data": ack})
+
+		return client.Flush(true)
+	}
+
+	first := connect(-1)
+	if len(first) != 2 {
+		t.Fatalf("Expected Message With Connect Reply, got %v", first)
+	}
+	stamped := first[1].(map[string]interface{})["ext"].(map[string]interface{})["ack"].(int)
+
+	// The response was lost, so the client acks the batch before it again.
+	redelivered := connect(stamped - 1)
+	if len(redelivered) != 3 || redelivered[0].(map[string]interface{})["data"] != float64(-1) {
+		t.Errorf("Message Flushed With Batch %d Not Redelivered: %v", stamped, redelivered)
+	}
+}
@@ -0,0 +1,95 @@
+package bayeux
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	ErrMissingCredentials = errors.New("missing credentials")
+	ErrInvalidToken       = errors.New("invalid token")
+	ErrExpiredToken       = errors.New("expired token")
+)
+
+// Authenticator verifies the credentials a client sends in the ext field of
+// /meta/handshake. The returned identity is attached to the client. Returning
+// a nil identity and a nil error lets the client in anonymously.
+type Authenticator interface {
+	Authenticate(client Client, ext map[string]interface{}) (interface{}, error)
+}
+
+// TokenClaims is the identity carried by tokens from SignToken.
+type TokenClaims struct {
+	Subject string `json:"sub"`
+	Expires int64  `json:"exp,omitempty"`
+}
+
+type hmacAuthenticator struct {
+	key []byte
+}
+
+// NewHMACAuthenticator verifies tokens minted by SignToken with the same key.
+// Clients send them as {"ext": {"authentication": {"token": "..."}}} and are
+// identified by the token's *TokenClaims.
+func NewHMACAuthenticator(key []byte) Authenticator {
+	return &hmacAuthenticator{key}
+}
+
+// SignToken mints a token for subject, valid until expires. A zero expires
+// never expires.
+func SignToken(key []byte, subject string, expires time.Time) string {
+	claims := &TokenClaims{subject, 0}
+	if !expires.IsZero() {
+		claims.Expires = expires.Unix()
+	}
+
+	payload, _ := json.Marshal(claims)
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(sign(key, encoded))
+}
+
+func sign(key []byte, payload string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+func (a *hmacAuthenticator) Authenticate(client Client, ext map[string]interface{}) (interface{}, error) {
+	authentication, _ := ext["authentication"].(map[string]interface{})
+	token, _ := authentication["token"].(string)
+	if token == "" {
+		return nil, ErrMissingCredentials
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return nil, ErrInvalidToken
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(signature, sign(a.key, parts[0])) {
+		return nil, ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	claims := &TokenClaims{}
+	if err := json.Unmarshal(payload, claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	if claims.Expires != 0 && time.Now().Unix() > claims.Expires {
+		return nil, ErrExpiredToken
+	}
+
+	return claims, nil
+}
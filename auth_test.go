@@ -0,0 +1,60 @@
+package bayeux
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ebittleman/go-bayeux/messages"
+)
+
+func authExt(token string) map[string]interface{} {
+	return map[string]interface{}{"authentication": map[string]interface{}{"token": token}}
+}
+
+func TestHMACAuthenticator(t *testing.T) {
+	key := []byte("secret")
+	auth := NewHMACAuthenticator(key)
+
+	identity, err := auth.Authenticate(nil, authExt(SignToken(key, "alice", time.Now().Add(time.Minute))))
+	if err != nil || identity.(*TokenClaims).Subject != "alice" {
+		t.Errorf("Unexpected Result %v %v", identity, err)
+	}
+
+	if _, err := auth.Authenticate(nil, nil); err != ErrMissingCredentials {
+		t.Errorf("Unexpected Error %v", err)
+	}
+	if _, err := auth.Authenticate(nil, authExt(SignToken([]byte("other"), "alice", time.Time{}))); err != ErrInvalidToken {
+		t.Errorf("Unexpected Error %v", err)
+	}
+	if _, err := auth.Authenticate(nil, authExt(SignToken(key, "alice", time.Now().Add(-time.Minute)))); err != ErrExpiredToken {
+		t.Errorf("Unexpected Error %v", err)
+	}
+}
+
+func TestHandshakeAuthentication(t *testing.T) {
+	key := []byte("secret")
+
+	server := Handler(WithAuthenticator(NewHMACAuthenticator(key)))
+	defer server.Close()
+	bs := server.(*bayeuxServer)
+
+	reply := longPollHandshake(t, server, CLIENT_LONGPOLL)
+	if reply.Successful || reply.AuthSuccessful || !strings.HasPrefix(reply.Error, "403:") {
+		t.Errorf("Unauthenticated Handshake Was Accepted %v", reply)
+	}
+
+	replies, _ := bs.HandleLongPoll([]map[string]interface{}{
+		{"channel": "/meta/handshake", "version": "1.0", "supportedConnectionTypes": []string{CLIENT_LONGPOLL}, "ext": authExt(SignToken(key, "alice", time.Time{}))},
+	})
+
+	reply = replies[0].(*messages.HandshakeResponse)
+	if !reply.Successful || !reply.AuthSuccessful {
+		t.Fatalf("Authenticated Handshake Was Rejected %v", reply)
+	}
+
+	identity, _ := server.GetClient(reply.ClientId).GetIdentity().(*TokenClaims)
+	if identity == nil || identity.Subject != "alice" {
+		t.Errorf("Unexpected Identity %v", identity)
+	}
+}
@@ -0,0 +1,91 @@
+package bayeux
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/ebittleman/go-bayeux/messages"
+)
+
+// setBatchWindow is how long a streaming transport waits after the first
+// queued message for more to send in the same frame. Zero, the default, only
+// coalesces messages that are already queued.
+func (bs *bayeuxServer) setBatchWindow(window time.Duration) {
+	bs.batchWindow = window
+}
+
+// setMaxBatchSize caps the number of messages sent in one frame. Zero or
+// less is unbounded.
+func (bs *bayeuxServer) setMaxBatchSize(size int) {
+	bs.maxBatchSize = size
+}
+
+// setMaxBatchBytes caps the encoded size of a frame. A single message larger
+// than the cap is still sent alone. Zero or less is unbounded.
+func (bs *bayeuxServer) setMaxBatchBytes(size int) {
+	bs.maxBatchBytes = size
+}
+
+// nextBatch takes the messages for the next frame off the queue, waiting up
+// to the batch window for more after the first. It returns the encoded frame
+// along with its messages, so they can be put back if the write fails, or
+// nil if the queue is empty.
+func (c *baseClient) nextBatch(stop <-chan struct{}) ([]byte, []messages.Message) {
+	maxSize := c.config.maxBatchSize
+	maxBytes := c.config.maxBatchBytes
+
+	var timeout <-chan time.Time
+	if window := c.config.batchWindow; window > 0 {
+		timer := time.NewTimer(window)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	batch := make([]messages.Message, 0)
+	parts := make([][]byte, 0)
+	size := 0
+
+collect:
+	for maxSize <= 0 || len(batch) < maxSize {
+		msg, ok := c.queue.Pop()
+		if !ok {
+			if len(batch) == 0 || timeout == nil {
+				break
+			}
+
+			select {
+			case <-c.queue.Ready():
+				continue
+			case <-timeout:
+			case <-stop:
+			}
+			break collect
+		}
+
+		encoded, err := messages.Encode(msg)
+		if err != nil {
+			c.GetLogger().Printf("Can't Encode Message: %s\n", err)
+			continue
+		}
+
+		if maxBytes > 0 && len(batch) > 0 && size+len(encoded) > maxBytes {
+			c.queue.PushFront(encoded)
+			break
+		}
+
+		batch = append(batch, encoded)
+		parts = append(parts, encoded)
+		size += len(encoded)
+	}
+
+	if len(batch) == 0 {
+		return nil, nil
+	}
+
+	frame := bytes.Buffer{}
+	frame.WriteByte('[')
+	frame.Write(bytes.Join(parts, []byte{','}))
+	frame.WriteByte(']')
+
+	return frame.Bytes(), batch
+}
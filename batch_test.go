@@ -0,0 +1,57 @@
+package bayeux
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextBatchLimits(t *testing.T) {
+	server := Handler()
+	defer server.Close()
+	bs := server.(*bayeuxServer)
+
+	client := NewLongPollClient(GenerateNewClientId(), server).(*longPollClient)
+	frames := func() []string {
+		result := make([]string, 0)
+		for {
+			frame, batch := client.nextBatch(nil)
+			if batch == nil {
+				return result
+			}
+			result = append(result, string(frame))
+		}
+	}
+
+	bs.setMaxBatchSize(2)
+	client.queue.Push(1, OVERFLOW_DROP_OLDEST)
+	client.queue.Push(2, OVERFLOW_DROP_OLDEST)
+	client.queue.Push(3, OVERFLOW_DROP_OLDEST)
+	if got := frames(); len(got) != 2 || got[0] != "[1,2]" || got[1] != "[3]" {
+		t.Errorf("Unexpected Frames For Batch Size: %v", got)
+	}
+
+	bs.setMaxBatchSize(0)
+	bs.setMaxBatchBytes(3)
+	client.queue.Push(1, OVERFLOW_DROP_OLDEST)
+	client.queue.Push(22, OVERFLOW_DROP_OLDEST)
+	client.queue.Push(333, OVERFLOW_DROP_OLDEST)
+	if got := frames(); len(got) != 2 || got[0] != "[1,22]" || got[1] != "[333]" {
+		t.Errorf("Unexpected Frames For Batch Bytes: %v", got)
+	}
+}
+
+func TestNextBatchWindow(t *testing.T) {
+	server := Handler(WithBatching(100*time.Millisecond, 0, 0))
+	defer server.Close()
+
+	client := NewLongPollClient(GenerateNewClientId(), server).(*longPollClient)
+	client.queue.Push(1, OVERFLOW_DROP_OLDEST)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		client.queue.Push(2, OVERFLOW_DROP_OLDEST)
+	}()
+
+	if frame, _ := client.nextBatch(nil); string(frame) != "[1,2]" {
+		t.Errorf("Messages Within The Window Not Coalesced: %s", frame)
+	}
+}
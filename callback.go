@@ -0,0 +1,49 @@
+package bayeux
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+)
+
+var callbackNamePattern = regexp.MustCompile(`^[a-zA-Z_$][a-zA-Z0-9_$.]*$`)
+
+// ServeCallbackPoll implements the callback-polling transport. Messages
+// arrive in the "message" query parameter and the replies are wrapped in a
+// call to the function named by the "jsonp" parameter.
+func (bs *bayeuxServer) ServeCallbackPoll(resp http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		http.Error(resp, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	callback := req.URL.Query().Get("jsonp")
+	if !callbackNamePattern.MatchString(callback) {
+		http.Error(resp, "Invalid Callback, bad request", http.StatusBadRequest)
+		return
+	}
+
+	msgs := make([]map[string]interface{}, 0)
+	err := json.Unmarshal([]byte(req.URL.Query().Get("message")), &msgs)
+	if err != nil || len(msgs) == 0 {
+		http.Error(resp, "Parse Error, bad request", http.StatusBadRequest)
+		return
+	}
+
+	replies, err := bs.HandleLongPoll(msgs)
+	if err != nil {
+		http.Error(resp, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	output, err := EncodeBatch(replies)
+	if err != nil {
+		http.Error(resp, "Error Formatting Response", http.StatusInternalServerError)
+		return
+	}
+
+	resp.Header().Set("Content-Type", "text/javascript;charset=UTF-8")
+	resp.Write([]byte(callback + "("))
+	resp.Write(output)
+	resp.Write([]byte(");"))
+}
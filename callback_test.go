@@ -0,0 +1,55 @@
+package bayeux
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestCallbackPollHandshake(t *testing.T) {
+	server := Handler()
+	defer server.Close()
+
+	msgs, _ := json.Marshal([]map[string]interface{}{
+		{"channel": "/meta/handshake", "version": "1.0", "supportedConnectionTypes": []string{CLIENT_CALLBACK}, "id": "1"},
+	})
+	query := url.Values{"jsonp": {"cb_1"}, "message": {string(msgs)}}
+
+	req := httptest.NewRequest("GET", "/cometd/handshake?"+query.Encode(), nil)
+	resp := httptest.NewRecorder()
+	server.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Unexpected Status %d: %s", resp.Code, resp.Body.String())
+	}
+
+	body := resp.Body.String()
+	if !strings.HasPrefix(body, "cb_1(") || !strings.HasSuffix(body, ");") {
+		t.Fatalf("Response Not Wrapped In Callback %q", body)
+	}
+
+	replies := make([]map[string]interface{}, 0)
+	if err := json.Unmarshal([]byte(body[len("cb_1("):len(body)-2]), &replies); err != nil {
+		t.Fatal(err)
+	}
+	if len(replies) != 1 || replies[0]["successful"] != true {
+		t.Errorf("Unexpected Replies %v", replies)
+	}
+}
+
+func TestCallbackPollRejectsBadCallback(t *testing.T) {
+	server := Handler()
+	defer server.Close()
+
+	query := url.Values{"jsonp": {"alert(1);x"}, "message": {"[]"}}
+	req := httptest.NewRequest("GET", "/cometd?"+query.Encode(), nil)
+	resp := httptest.NewRecorder()
+	server.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusBadRequest {
+		t.Errorf("Unexpected Status %d", resp.Code)
+	}
+}
@@ -19,6 +19,8 @@ type Channel interface {
 	GetName() string
 	AddSubscription(Subscriber, MessageHandler)
 	RemoveSubscription(Subscriber)
+	GetSubscriptions() map[string]MessageHandler
+	Len() int
 	Publish(messages.Message)
 }
 
@@ -68,10 +70,48 @@ func (c *channel) RemoveSubscription(subscriber Subscriber) {
 	subscriber.Unsubscribe(c)
 }
 
-func (c *channel) Publish(m messages.Message) {
+// GetSubscriptions returns a copy of the channel's handlers keyed by
+// subscriber id.
+func (c *channel) GetSubscriptions() map[string]MessageHandler {
 	c.lock.Lock()
-	for _, messageHandler := range c.subscriptions {
-		go messageHandler(m)
+	subscriptions := make(map[string]MessageHandler, len(c.subscriptions))
+	for id, messageHandler := range c.subscriptions {
+		subscriptions[id] = messageHandler
 	}
 	c.lock.Unlock()
+
+	return subscriptions
+}
+
+// Len counts the channel's subscribers.
+func (c *channel) Len() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return len(c.subscriptions)
+}
+
+func (c *channel) Publish(m messages.Message) {
+	Broadcast([]Channel{c}, m)
+}
+
+// Broadcast publishes m to every subscriber of channels, delivering it once
+// to subscribers found on more than one of them. m is encoded once and the
+// same bytes handed to every subscriber, so handlers must not block.
+func Broadcast(channels []Channel, m messages.Message) {
+	if encoded, err := messages.Encode(m); err == nil {
+		m = encoded
+	}
+
+	handlers := make(map[string]MessageHandler)
+	for _, c := range channels {
+		for id, messageHandler := range c.GetSubscriptions() {
+			if _, ok := handlers[id]; !ok {
+				handlers[id] = messageHandler
+			}
+		}
+	}
+
+	for _, messageHandler := range handlers {
+		messageHandler(m)
+	}
 }
@@ -0,0 +1,57 @@
+package channel
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ebittleman/go-bayeux/messages"
+)
+
+type testSubscriber struct {
+	id string
+}
+
+func (s *testSubscriber) GetId() string                     { return s.id }
+func (s *testSubscriber) Subscribe(Channel)                 {}
+func (s *testSubscriber) Unsubscribe(Channel)               {}
+func (s *testSubscriber) Publish(Channel, messages.Message) {}
+
+func TestBroadcastDeliversOnce(t *testing.T) {
+	var (
+		lock     sync.Mutex
+		received = make(map[string]int)
+		wg       sync.WaitGroup
+	)
+
+	handler := func(id string) MessageHandler {
+		return func(messages.Message) {
+			lock.Lock()
+			received[id]++
+			lock.Unlock()
+			wg.Done()
+		}
+	}
+
+	exact := NewChannel("/stocks/AAPL")
+	single := NewChannel("/stocks/*")
+	deep := NewChannel("/stocks/**")
+
+	a := &testSubscriber{"a"}
+	b := &testSubscriber{"b"}
+	exact.AddSubscription(a, handler("a"))
+	single.AddSubscription(a, handler("a"))
+	deep.AddSubscription(a, handler("a"))
+	deep.AddSubscription(b, handler("b"))
+
+	wg.Add(2)
+	Broadcast([]Channel{exact, single, deep}, "msg")
+	wg.Wait()
+	time.Sleep(10 * time.Millisecond)
+
+	lock.Lock()
+	defer lock.Unlock()
+	if received["a"] != 1 || received["b"] != 1 {
+		t.Errorf("Unexpected Deliveries %v", received)
+	}
+}
@@ -0,0 +1,78 @@
+package channel
+
+import (
+	"strings"
+)
+
+const (
+	WILDCARD      = "*"
+	DEEP_WILDCARD = "**"
+
+	META_PREFIX    = "/meta/"
+	SERVICE_PREFIX = "/service/"
+)
+
+// Segments splits a channel name like "/foo/bar" into ["foo", "bar"].
+func Segments(name string) []string {
+	return strings.Split(strings.Trim(name, "/"), "/")
+}
+
+// IsValid reports whether name is an absolute channel name without empty
+// segments, like "/foo/bar".
+func IsValid(name string) bool {
+	if !strings.HasPrefix(name, "/") {
+		return false
+	}
+
+	for _, segment := range strings.Split(name[1:], "/") {
+		if segment == "" {
+			return false
+		}
+	}
+
+	return true
+}
+
+// IsMeta reports whether name is a /meta/** protocol channel.
+func IsMeta(name string) bool {
+	return strings.HasPrefix(name, META_PREFIX)
+}
+
+// IsService reports whether name is a /service/** channel. Messages on
+// service channels go to server side handlers and are never broadcast.
+func IsService(name string) bool {
+	return strings.HasPrefix(name, SERVICE_PREFIX)
+}
+
+// IsWildcard reports whether name ends in a "*" or "**" segment.
+func IsWildcard(name string) bool {
+	return strings.HasSuffix(name, "/"+WILDCARD) || strings.HasSuffix(name, "/"+DEEP_WILDCARD)
+}
+
+// Match reports whether the channel name is matched by pattern. A trailing
+// "*" matches exactly one segment and a trailing "**" matches one or more.
+// Patterns without a wildcard only match themselves.
+func Match(pattern, name string) bool {
+	if !IsWildcard(pattern) {
+		return pattern == name
+	}
+
+	p := Segments(pattern)
+	n := Segments(name)
+	last := len(p) - 1
+
+	if len(n) < len(p) {
+		return false
+	}
+	if p[last] == WILDCARD && len(n) != len(p) {
+		return false
+	}
+
+	for i := 0; i < last; i++ {
+		if p[i] != n[i] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,49 @@
+package channel
+
+import (
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	cases := []struct {
+		pattern, name string
+		expected      bool
+	}{
+		{"/foo/bar", "/foo/bar", true},
+		{"/foo/bar", "/foo/baz", false},
+		{"/foo/*", "/foo/bar", true},
+		{"/foo/*", "/foo/bar/baz", false},
+		{"/foo/*", "/foo", false},
+		{"/foo/*", "/bar/baz", false},
+		{"/foo/**", "/foo/bar", true},
+		{"/foo/**", "/foo/bar/baz", true},
+		{"/foo/**", "/foo", false},
+		{"/**", "/foo/bar", true},
+		{"/*", "/foo", true},
+	}
+
+	for _, c := range cases {
+		if actual := Match(c.pattern, c.name); actual != c.expected {
+			t.Errorf("Match(%q, %q) = %v, expected %v", c.pattern, c.name, actual, c.expected)
+		}
+	}
+}
+
+func TestIsValid(t *testing.T) {
+	cases := map[string]bool{
+		"/foo":      true,
+		"/foo/bar":  true,
+		"/foo/**":   true,
+		"":          false,
+		"/":         false,
+		"foo":       false,
+		"/foo/":     false,
+		"/foo//bar": false,
+	}
+
+	for name, expected := range cases {
+		if actual := IsValid(name); actual != expected {
+			t.Errorf("IsValid(%q) = %v, expected %v", name, actual, expected)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package channel
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+type node struct {
+	segment  string
+	path     string
+	channel  Channel
+	parent   *node
+	children map[string]*node
+}
+
+type tree struct {
+	root *node
+	lock *sync.RWMutex
+}
+
+// Tree indexes channels by their segments so that lookups, wildcard
+// matching and prefix queries only walk the branches involved.
+type Tree interface {
+	Get(string) Channel
+	GetOrCreate(string) Channel
+	Match(string) []Channel
+	Children(string) []string
+	Prune(string)
+	Len() int
+}
+
+func NewTree() Tree {
+	return &tree{newNode("", nil), &sync.RWMutex{}}
+}
+
+func newNode(segment string, parent *node) *node {
+	path := ""
+	if parent != nil {
+		path = parent.path + "/" + segment
+	}
+
+	return &node{segment, path, nil, parent, make(map[string]*node)}
+}
+
+// find walks to the node for name, returning nil if it does not exist.
+func (t *tree) find(name string) *node {
+	n := t.root
+	for _, segment := range Segments(name) {
+		n = n.children[segment]
+		if n == nil {
+			return nil
+		}
+	}
+
+	return n
+}
+
+func (t *tree) Get(name string) Channel {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	n := t.find(name)
+	if n == nil {
+		return nil
+	}
+
+	return n.channel
+}
+
+func (t *tree) GetOrCreate(name string) Channel {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	n := t.root
+	for _, segment := range Segments(name) {
+		child, ok := n.children[segment]
+		if !ok {
+			child = newNode(segment, n)
+			n.children[segment] = child
+		}
+		n = child
+	}
+
+	if n.channel == nil {
+		n.channel = NewChannel(n.path)
+	}
+
+	return n.channel
+}
+
+// Match returns the channel named name, if any, followed by every wildcard
+// channel matching it.
+func (t *tree) Match(name string) []Channel {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	matched := make([]Channel, 0)
+	segments := Segments(name)
+
+	n := t.root
+	for i, segment := range segments {
+		if deep, ok := n.children[DEEP_WILDCARD]; ok && deep.channel != nil {
+			matched = append(matched, deep.channel)
+		}
+		if i == len(segments)-1 {
+			if single, ok := n.children[WILDCARD]; ok && single.channel != nil {
+				matched = append(matched, single.channel)
+			}
+		}
+
+		n = n.children[segment]
+		if n == nil {
+			return matched
+		}
+	}
+
+	if n.channel != nil {
+		matched = append([]Channel{n.channel}, matched...)
+	}
+
+	return matched
+}
+
+// Children lists the paths directly below path in sorted order, whether or
+// not a channel exists at them.
+func (t *tree) Children(path string) []string {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	n := t.root
+	if strings.Trim(path, "/") != "" {
+		n = t.find(path)
+	}
+	if n == nil {
+		return []string{}
+	}
+
+	children := make([]string, 0, len(n.children))
+	for _, child := range n.children {
+		children = append(children, child.path)
+	}
+	sort.Strings(children)
+
+	return children
+}
+
+// Prune removes the channel named name if it has no subscribers, then
+// removes any branches left empty.
+func (t *tree) Prune(name string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	n := t.find(name)
+	if n == nil {
+		return
+	}
+
+	if n.channel != nil && n.channel.Len() == 0 {
+		n.channel = nil
+	}
+
+	for n.parent != nil && n.channel == nil && len(n.children) == 0 {
+		delete(n.parent.children, n.segment)
+		n = n.parent
+	}
+}
+
+// Len counts the channels in the tree.
+func (t *tree) Len() int {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	count := 0
+	nodes := []*node{t.root}
+	for len(nodes) > 0 {
+		n := nodes[len(nodes)-1]
+		nodes = nodes[:len(nodes)-1]
+
+		if n.channel != nil {
+			count++
+		}
+		for _, child := range n.children {
+			nodes = append(nodes, child)
+		}
+	}
+
+	return count
+}
@@ -0,0 +1,79 @@
+package channel
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/ebittleman/go-bayeux/messages"
+)
+
+func channelNames(channels []Channel) []string {
+	names := make([]string, 0, len(channels))
+	for _, c := range channels {
+		names = append(names, c.GetName())
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func TestTreeMatch(t *testing.T) {
+	tree := NewTree()
+	for _, name := range []string{"/stocks/AAPL", "/stocks/*", "/stocks/**", "/**", "/stocks/AAPL/*", "/news/*"} {
+		tree.GetOrCreate(name)
+	}
+
+	actual := channelNames(tree.Match("/stocks/AAPL"))
+	expected := []string{"/**", "/stocks/*", "/stocks/**", "/stocks/AAPL"}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Unexpected Matches %v", actual)
+	}
+
+	actual = channelNames(tree.Match("/stocks/AAPL/bid"))
+	expected = []string{"/**", "/stocks/**", "/stocks/AAPL/*"}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Unexpected Matches %v", actual)
+	}
+
+	if tree.Get("/stocks/AAPL") != tree.GetOrCreate("/stocks/AAPL") {
+		t.Error("GetOrCreate Replaced An Existing Channel")
+	}
+}
+
+func TestTreeChildren(t *testing.T) {
+	tree := NewTree()
+	tree.GetOrCreate("/stocks/AAPL")
+	tree.GetOrCreate("/stocks/GOOG/bid")
+	tree.GetOrCreate("/news")
+
+	if actual := tree.Children("/"); !reflect.DeepEqual(actual, []string{"/news", "/stocks"}) {
+		t.Errorf("Unexpected Children %v", actual)
+	}
+	if actual := tree.Children("/stocks"); !reflect.DeepEqual(actual, []string{"/stocks/AAPL", "/stocks/GOOG"}) {
+		t.Errorf("Unexpected Children %v", actual)
+	}
+	if actual := tree.Children("/missing"); len(actual) != 0 {
+		t.Errorf("Unexpected Children %v", actual)
+	}
+}
+
+func TestTreePrune(t *testing.T) {
+	tree := NewTree()
+	tree.GetOrCreate("/stocks/GOOG/bid")
+	held := tree.GetOrCreate("/stocks/AAPL")
+	held.AddSubscription(&testSubscriber{"a"}, func(messages.Message) {})
+
+	tree.Prune("/stocks/GOOG/bid")
+	tree.Prune("/stocks/AAPL")
+
+	if tree.Get("/stocks/GOOG/bid") != nil {
+		t.Error("Empty Channel Was Not Pruned")
+	}
+	if actual := tree.Children("/stocks"); !reflect.DeepEqual(actual, []string{"/stocks/AAPL"}) {
+		t.Errorf("Empty Branch Was Not Pruned %v", actual)
+	}
+	if tree.Get("/stocks/AAPL") != held || tree.Len() != 1 {
+		t.Error("Subscribed Channel Was Pruned")
+	}
+}
@@ -3,10 +3,8 @@ package bayeux
 import (
 	"encoding/json"
 	"log"
-	"net/http"
 	"sync"
-
-	"code.google.com/p/go.net/websocket"
+	"time"
 
 	"github.com/ebittleman/go-bayeux/channel"
 	"github.com/ebittleman/go-bayeux/messages"
@@ -15,15 +13,29 @@ import (
 type baseClient struct {
 	id           string
 	server       Server
+	config       *config
+	self         Client
 	channels     map[string]channel.Channel
 	channelsLock *sync.Mutex
-	responses    chan interface{}
+	queue        *messageQueue
 	done         chan struct{}
 	logger       *log.Logger
+	identity     interface{}
+	lastSeen     time.Time
+	state        int
+	violations   int
+	extensions   []ServerExtension
+	lock         *sync.Mutex
 }
 
 type websocketClient struct {
-	ws *websocket.Conn
+	ws          WebSocketConn
+	lost        chan struct{}
+	grace       *time.Timer
+	closeOnce   *sync.Once
+	closing     chan struct{}
+	closeCode   int
+	closingOnce *sync.Once
 	baseClient
 }
 
@@ -33,9 +45,44 @@ type Client interface {
 	OnMessage(string, []byte)
 	SendMessage(messages.Message)
 	GetLogger() *log.Logger
+	SetIdentity(interface{})
+	GetIdentity() interface{}
+	Touch()
+	GetLastSeen() time.Time
+	SetState(int)
+	GetState() int
+	Hold(time.Duration)
+	AddViolation() int
+	AddExtension(ServerExtension)
+	GetExtensions() []ServerExtension
 	channel.Subscriber
 }
 
+// newBaseClient creates the state shared by every transport. The transport
+// must point self at the client embedding it, so that extensions, listeners
+// and subscriptions see the same Client as the rest of the server.
+func newBaseClient(id string, server Server) baseClient {
+	cfg := configOf(server)
+
+	return baseClient{
+		id,
+		server,
+		cfg,
+		nil,
+		make(map[string]channel.Channel),
+		&sync.Mutex{},
+		newMessageQueue(cfg.queueLimit),
+		make(chan struct{}),
+		server.GetLogger(),
+		nil,
+		time.Now(),
+		STATE_UNCONNECTED,
+		0,
+		make([]ServerExtension, 0),
+		&sync.Mutex{},
+	}
+}
+
 func (c *baseClient) GetId() string {
 	return c.id
 }
@@ -54,7 +101,7 @@ func (c *baseClient) Subscribe(ch channel.Channel) {
 	c.channelsLock.Unlock()
 
 	ch.AddSubscription(c, func(msg messages.Message) {
-		c.SendMessage(msg)
+		c.self.SendMessage(msg)
 	})
 }
 
@@ -80,9 +127,18 @@ func (c *baseClient) Unsubscribe(ch channel.Channel) {
 func (c *baseClient) Wait() {}
 
 func (c *baseClient) Close() error {
+	c.SetState(STATE_UNCONNECTED)
+
+	c.channelsLock.Lock()
+	channels := make([]channel.Channel, 0, len(c.channels))
+	for _, ch := range c.channels {
+		channels = append(channels, ch)
+	}
+	c.channelsLock.Unlock()
 
-	for _, channel := range c.channels {
-		c.Unsubscribe(channel)
+	for _, ch := range channels {
+		c.Unsubscribe(ch)
+		c.server.GetChannels().Prune(ch.GetName())
 	}
 
 	c.server.UnregisterClient(c.GetId())
@@ -94,142 +150,320 @@ func (c *baseClient) GetLogger() *log.Logger {
 	return c.logger
 }
 
+// SetIdentity attaches the authenticated identity of the session.
+func (c *baseClient) SetIdentity(identity interface{}) {
+	c.lock.Lock()
+	c.identity = identity
+	c.lock.Unlock()
+}
+
+// Touch records that the client is alive, it is called for every
+// /meta/connect.
+func (c *baseClient) Touch() {
+	c.lock.Lock()
+	c.lastSeen = time.Now()
+	c.lock.Unlock()
+}
+
+func (c *baseClient) GetLastSeen() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.lastSeen
+}
+
+func (c *baseClient) SetState(state int) {
+	c.lock.Lock()
+	c.state = state
+	c.lock.Unlock()
+}
+
+// GetState returns one of STATE_UNCONNECTED, STATE_CONNECTING, after a
+// successful handshake, or STATE_CONNECTED, after the first /meta/connect.
+func (c *baseClient) GetState() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.state
+}
+
+// AddViolation counts a malformed message from the client, returning the
+// total so far.
+func (c *baseClient) AddViolation() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.violations++
+	return c.violations
+}
+
+// Hold delays a /meta/connect reply for timeout or until the client is
+// closed. Messages to streaming clients are not held behind the connect.
+func (c *baseClient) Hold(timeout time.Duration) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-c.done:
+	}
+}
+
+// GetIdentity returns the identity set during handshake, or nil for
+// anonymous clients.
+func (c *baseClient) GetIdentity() interface{} {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.identity
+}
+
 func (c *baseClient) OnMessage(ch string, payload []byte) {
 	c.server.OnReceiveMessage(ch, c.GetId(), payload)
 }
 
 func (c *baseClient) SendMessage(msg messages.Message) {
-	go func(c *baseClient, msg messages.Message) {
-		c.responses <- msg
-	}(c, msg)
+	msg, ok := ExtendOutgoing(c.server, c.self, msg)
+	if !ok {
+		return
+	}
+
+	c.enqueue(msg)
 }
 
-func NewClient(id string, ws *websocket.Conn, server Server) Client {
-	client := &websocketClient{
-		ws,
-		baseClient{
-			id, server,
-			make(map[string]channel.Channel),
-			&sync.Mutex{},
-			make(chan interface{}),
-			make(chan struct{}),
-			logger,
-		},
+func (c *baseClient) enqueue(msg messages.Message) {
+	dropped, overflowed := c.queue.Push(msg, c.config.overflowPolicy)
+	if overflowed {
+		c.onQueueOverflow(dropped)
 	}
+}
 
-	go client.IncomingLoop()
-	go client.OutgoingLoop()
+func NewClient(id string, ws WebSocketConn, server Server) Client {
+	client := newWebSocketClient(id, server)
+	client.attach(ws, nil, nil)
 
 	return client
 }
 
-func (c *websocketClient) Wait() {
-	<-c.done
+func newWebSocketClient(id string, server Server) *websocketClient {
+	client := &websocketClient{
+		nil,
+		nil,
+		nil,
+		&sync.Once{},
+		make(chan struct{}),
+		CLOSE_NORMAL,
+		&sync.Once{},
+		newBaseClient(id, server),
+	}
+	client.self = client
+
+	return client
 }
 
-func (c *websocketClient) Close() error {
+// attach starts serving the client over ws, beginning with first, the frame
+// already read from it, and its read error. It returns a channel that is
+// closed once ws is released, or nil if the client is closed or already has
+// a connection.
+func (c *websocketClient) attach(ws WebSocketConn, first []map[string]interface{}, err error) chan struct{} {
+	c.lock.Lock()
+	defer c.lock.Unlock()
 
-	err := c.baseClient.Close()
+	select {
+	case <-c.done:
+		return nil
+	default:
+	}
 
-	if err != nil {
-		return err
+	if c.ws != nil {
+		return nil
 	}
 
-	c.GetLogger().Println("Client Disconnected")
-	c.ws.Close()
+	if c.grace != nil {
+		c.grace.Stop()
+		c.grace = nil
+	}
 
-	if c.done == nil {
-		return nil
+	c.ws = ws
+	c.lost = make(chan struct{})
+
+	go c.IncomingLoop(ws, first, err)
+	go c.OutgoingLoop(ws, c.lost)
+
+	return c.lost
+}
+
+// release gives up ws after it failed. Sessions that completed a handshake
+// are kept for the server's resume grace period, anything else is closed.
+func (c *websocketClient) release(ws WebSocketConn) {
+	grace := c.config.resumeGrace
+	if grace <= 0 || c.GetState() == STATE_UNCONNECTED {
+		c.Close()
+		return
 	}
 
-	close(c.done)
+	c.lock.Lock()
+	if c.ws != ws {
+		c.lock.Unlock()
+		return
+	}
+	select {
+	case <-c.closing:
+		// The session was being closed, there is nothing to resume.
+		c.lock.Unlock()
+		c.Close()
+		return
+	default:
+	}
+	c.ws = nil
+	close(c.lost)
+	c.grace = time.AfterFunc(grace, c.expire)
+	c.lock.Unlock()
 
-	return nil
+	ws.Close(CLOSE_GOING_AWAY, "")
+	c.GetLogger().Println("Client Detached")
 }
 
-func (c *websocketClient) IncomingLoop() {
-	for {
-		err := c.ReceiveMesages()
+func (c *websocketClient) expire() {
+	c.lock.Lock()
+	detached := c.ws == nil
+	c.lock.Unlock()
+
+	if detached {
+		c.GetLogger().Printf("Resume Grace Period Expired '%s'\n", c.GetId())
+		c.Close()
+	}
+}
+
+func (c *websocketClient) Wait() {
+	<-c.done
+}
+
+func (c *websocketClient) Close() error {
+	var err error
+
+	c.closeOnce.Do(func() {
+		err = c.baseClient.Close()
 		if err != nil {
-			c.Close()
 			return
 		}
+
+		c.GetLogger().Println("Client Disconnected")
+
+		c.lock.Lock()
+		ws, code := c.ws, c.closeCode
+		c.ws = nil
+		if ws != nil {
+			close(c.lost)
+		}
+		if c.grace != nil {
+			c.grace.Stop()
+		}
+		c.lock.Unlock()
+
+		if ws != nil {
+			ws.Close(code, "")
+		}
+		close(c.done)
+	})
+
+	return err
+}
+
+// IncomingLoop dispatches first, then every frame read from ws after it, so
+// that the messages of a connection are routed in the order they were sent.
+func (c *websocketClient) IncomingLoop(ws WebSocketConn, first []map[string]interface{}, err error) {
+	err = c.HandleFrame(first, err)
+	for err == nil {
+		err = c.ReceiveMesages(ws)
 	}
+
+	c.release(ws)
 }
 
-func (c *websocketClient) OutgoingLoop() {
+// closeAfterFlush closes the session once the messages already queued, such
+// as the reply explaining why, have been written, and the connection with
+// code.
+func (c *websocketClient) closeAfterFlush(code int) {
+	c.closingOnce.Do(func() {
+		c.lock.Lock()
+		c.closeCode = code
+		attached := c.ws != nil
+		close(c.closing)
+		c.lock.Unlock()
+
+		if !attached {
+			c.Close()
+		}
+	})
+}
+
+func (c *websocketClient) OutgoingLoop(ws WebSocketConn, lost chan struct{}) {
 	for {
+		if !c.writeQueued(ws, lost) {
+			return
+		}
+
 		select {
-		case msg := <-c.responses:
-			err := websocket.JSON.Send(c.ws, &[]interface{}{msg})
-			if err != nil {
+		case <-c.queue.Ready():
+		case <-c.closing:
+			if c.writeQueued(ws, lost) {
 				c.Close()
-				return
 			}
+			return
+		case <-lost:
+			return
 		case <-c.done:
 			return
 		}
 	}
 }
 
-func (c *websocketClient) ReceiveMesages() error {
-	msgs := make([]map[string]interface{}, 0)
-	err := websocket.JSON.Receive(c.ws, &msgs)
-	for _, msg := range msgs {
-		payload, _ := json.Marshal(msg)
-		channel := msg["channel"]
-		go c.OnMessage(channel.(string), payload)
-	}
-
-	return err
-}
+// writeQueued writes frames until the queue is empty. It returns false if
+// ws failed and was released.
+func (c *websocketClient) writeQueued(ws WebSocketConn, lost chan struct{}) bool {
+	for {
+		frame, batch := c.nextBatch(lost)
+		if batch == nil {
+			return true
+		}
 
-type longPollClient struct {
-	resp     http.ResponseWriter
-	req      *http.Request
-	respChan chan http.ResponseWriter
-	baseClient
+		err := ws.WriteFrame(frame)
+		if err != nil {
+			// Keep the messages for a resumed connection.
+			c.queue.PushFront(batch...)
+			c.release(ws)
+			return false
+		}
+	}
 }
 
-func NewLongPollClient(id string, resp http.ResponseWriter, req *http.Request, server Server) Client {
-	client := &longPollClient{
-		resp,
-		req,
-		make(chan http.ResponseWriter),
-		baseClient{
-			id,
-			server,
-			make(map[string]channel.Channel),
-			&sync.Mutex{},
-			make(chan interface{}),
-			make(chan struct{}),
-			logger,
-		},
-	}
-
-	// go client.IncomingLoop()
-	go client.OutgoingLoop()
-	go func(c *longPollClient, resp http.ResponseWriter) {
-		c.respChan <- resp
-	}(client, resp)
+func (c *websocketClient) ReceiveMesages(ws WebSocketConn) error {
+	msgs := make([]map[string]interface{}, 0)
+	err := ws.ReadJSON(&msgs)
 
-	return client
+	return c.HandleFrame(msgs, err)
 }
 
-func (c *longPollClient) OutgoingLoop() {
-	for {
-		resp := <-c.respChan
-		select {
-		case msg := <-c.responses:
-			output, err := json.Marshal(&[]interface{}{msg})
-			if err != nil {
-				http.Error(resp, "Error Formatting Response", 406)
-				c.Close()
-				return
-			}
-			resp.Write(output)
-		case <-c.done:
-			return
+// HandleFrame dispatches a frame read from the connection. A frame that is
+// not a JSON array of messages is reported, only transport failures are
+// returned.
+func (c *websocketClient) HandleFrame(msgs []map[string]interface{}, err error) error {
+	switch err.(type) {
+	case nil:
+	case *json.SyntaxError, *json.UnmarshalTypeError:
+		ReportProtocolError(c.server, messages.RawMessage{"", c.GetId(), nil}, err)
+		return nil
+	default:
+		return err
+	}
+
+	for _, msg := range msgs {
+		payload, err := json.Marshal(msg)
+		if err != nil {
+			ReportProtocolError(c.server, messages.RawMessage{"", c.GetId(), nil}, err)
+			continue
 		}
+
+		channel, _ := msg["channel"].(string)
+		c.OnMessage(channel, payload)
 	}
+
+	return nil
 }
@@ -0,0 +1,113 @@
+package bayeux
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/ebittleman/go-bayeux/messages"
+)
+
+// BayeuxError is a protocol error, rendered in the spec's
+// "code:args:message" format, e.g. "402:xj3sjdsjdsjad:Unknown Client ID".
+type BayeuxError struct {
+	Code    int
+	Args    []string
+	Message string
+}
+
+func NewError(code int, message string, args ...string) *BayeuxError {
+	return &BayeuxError{code, args, message}
+}
+
+func (e *BayeuxError) Error() string {
+	return fmt.Sprintf("%d:%s:%s", e.Code, strings.Join(e.Args, ","), e.Message)
+}
+
+// MessageId extracts the id of a raw message so failures can be correlated
+// with it. Numeric ids are formatted as strings.
+func MessageId(payload []byte) string {
+	msg := struct {
+		Id interface{} `json:"id"`
+	}{}
+	json.Unmarshal(payload, &msg)
+
+	switch id := msg.Id.(type) {
+	case string:
+		return id
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(id)
+	}
+}
+
+// SendError replies to senderId with an unsuccessful response for a message
+// on channelName. It is a no-op when the sender is gone.
+func SendError(bs Server, senderId string, channelName string, id string, err error, advice *messages.ConnectAdvice) {
+	sender := bs.GetClient(senderId)
+	if sender == nil {
+		bs.GetLogger().Printf("Dropping Error For Unknown Client '%s': %s\n", senderId, err)
+		return
+	}
+
+	sender.SendMessage(&messages.ErrorResponse{
+		channelName,
+		false,
+		err.Error(),
+		senderId,
+		id,
+		advice,
+	})
+}
+
+// SendUnknownClient tells senderId that clientId is not a known session and
+// that it must handshake again.
+func SendUnknownClient(bs Server, senderId string, channelName string, clientId string, id string) {
+	SendError(bs, senderId, channelName, id,
+		NewError(402, "Unknown client", clientId),
+		&messages.ConnectAdvice{RECONNECT_HANDSHAKE, 0, 0, 0})
+}
+
+// ReportProtocolError answers a message that could not be understood with a
+// 400 error and counts it against the sender, closing the session once the
+// server's violation limit is exceeded.
+func ReportProtocolError(bs Server, msg messages.RawMessage, err error) {
+	bayeuxErr, ok := err.(*BayeuxError)
+	if !ok {
+		bayeuxErr = NewError(400, err.Error())
+	}
+
+	bs.GetLogger().Printf("Protocol Error From '%s': %s\n", msg.ClientId, bayeuxErr)
+	SendError(bs, msg.ClientId, msg.Channel, MessageId(msg.Payload), bayeuxErr, nil)
+
+	sender := bs.GetClient(msg.ClientId)
+	if sender == nil {
+		return
+	}
+
+	limit := configOf(bs).violationLimit
+	if violations := sender.AddViolation(); limit > 0 && violations >= limit {
+		bs.GetLogger().Printf("Dropping '%s' After %d Protocol Errors\n", msg.ClientId, violations)
+		closeAfterFlush(sender, CLOSE_POLICY_VIOLATION)
+	}
+}
+
+// flushCloser is implemented by clients that write their queue from a loop
+// of their own.
+type flushCloser interface {
+	closeAfterFlush(code int)
+}
+
+// closeAfterFlush closes client once the messages already queued for it have
+// been sent, so that it gets the reply explaining why. Websocket connections
+// are closed with code. Polling clients are closed right away, their queue
+// is still flushed to the request being answered.
+func closeAfterFlush(client Client, code int) {
+	if c, ok := client.(flushCloser); ok {
+		c.closeAfterFlush(code)
+		return
+	}
+
+	client.Close()
+}
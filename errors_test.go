@@ -0,0 +1,152 @@
+package bayeux
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ebittleman/go-bayeux/messages"
+	"github.com/gorilla/websocket"
+)
+
+func TestBayeuxErrorFormat(t *testing.T) {
+	if actual := NewError(402, "Unknown client", "xj3sjdsjdsjad").Error(); actual != "402:xj3sjdsjdsjad:Unknown client" {
+		t.Errorf("Unexpected Error %q", actual)
+	}
+	if actual := NewError(403, "Denied", "a", "b").Error(); actual != "403:a,b:Denied" {
+		t.Errorf("Unexpected Error %q", actual)
+	}
+	if actual := NewError(500, "Failed").Error(); actual != "500::Failed" {
+		t.Errorf("Unexpected Error %q", actual)
+	}
+}
+
+func TestMessageId(t *testing.T) {
+	if actual := MessageId([]byte(`{"id":"7"}`)); actual != "7" {
+		t.Errorf("Unexpected Id %q", actual)
+	}
+	if actual := MessageId([]byte(`{"id":7}`)); actual != "7" {
+		t.Errorf("Unexpected Id %q", actual)
+	}
+	if actual := MessageId([]byte(`{}`)); actual != "" {
+		t.Errorf("Unexpected Id %q", actual)
+	}
+}
+
+func TestHandlerPanicIsReported(t *testing.T) {
+	server := Handler()
+	defer server.Close()
+	bs := server.(*bayeuxServer)
+
+	server.HandleFunc("/service/boom", func(msg messages.RawMessage) {
+		panic("boom")
+	})
+
+	clientId := longPollHandshake(t, server, CLIENT_LONGPOLL).ClientId
+	replies, _ := bs.HandleLongPoll([]map[string]interface{}{
+		{"channel": "/service/boom", "clientId": clientId, "id": "3"},
+	})
+
+	if len(replies) != 1 {
+		t.Fatalf("Unexpected Replies %v", replies)
+	}
+	reply := replies[0].(*messages.ErrorResponse)
+	if reply.Successful || reply.Error != "500::Internal Server Error" || reply.Id != "3" {
+		t.Errorf("Unexpected Reply %v", reply)
+	}
+}
+
+func TestUnknownChannelIsReported(t *testing.T) {
+	server := Handler()
+	defer server.Close()
+	bs := server.(*bayeuxServer)
+
+	clientId := longPollHandshake(t, server, CLIENT_LONGPOLL).ClientId
+	replies, _ := bs.HandleLongPoll([]map[string]interface{}{
+		{"channel": "/meta/foo", "clientId": clientId, "id": "4"},
+	})
+
+	if len(replies) != 1 {
+		t.Fatalf("Unexpected Replies %v", replies)
+	}
+	reply := replies[0].(*messages.ErrorResponse)
+	if reply.Successful || reply.Error != "400:/meta/foo:Unknown Channel" || reply.Id != "4" {
+		t.Errorf("Unexpected Reply %v", reply)
+	}
+}
+
+func TestSubscribeBeforeHandshake(t *testing.T) {
+	server := Handler()
+	defer server.Close()
+
+	ws, done := dialWebSocket(t, server)
+	defer done()
+
+	ws.WriteJSON([]map[string]interface{}{
+		{"channel": "/meta/subscribe", "clientId": "nobody", "subscription": "/foo", "id": "1"},
+	})
+
+	replies := make([]map[string]interface{}, 0)
+	if err := ws.ReadJSON(&replies); err != nil {
+		t.Fatal(err)
+	}
+	if len(replies) != 1 || replies[0]["successful"] != false || replies[0]["error"] != "402:nobody:Unknown client" {
+		t.Errorf("Unexpected Replies %v", replies)
+	}
+}
+
+func TestMalformedMessagesAreReported(t *testing.T) {
+	server := Handler(WithViolationLimit(3))
+	defer server.Close()
+
+	ws, done := dialWebSocket(t, server)
+	defer done()
+
+	frames := []interface{}{
+		map[string]interface{}{"channel": "/meta/handshake"},
+		[]map[string]interface{}{{"id": "2", "data": "no channel"}},
+		[]map[string]interface{}{{"channel": "/meta/subscribe", "id": "3", "subscription": 5}},
+	}
+
+	for i, frame := range frames[:2] {
+		ws.WriteJSON(frame)
+
+		replies := make([]map[string]interface{}, 0)
+		if err := ws.ReadJSON(&replies); err != nil {
+			t.Fatalf("Frame %d: %s", i, err)
+		}
+		if len(replies) != 1 || replies[0]["successful"] != false {
+			t.Fatalf("Frame %d: Unexpected Replies %v", i, replies)
+		}
+		if errMsg, _ := replies[0]["error"].(string); !strings.HasPrefix(errMsg, "400:") {
+			t.Errorf("Frame %d: Unexpected Error %q", i, errMsg)
+		}
+	}
+
+	// The third violation reaches the limit and drops the session, after
+	// its reply has been written.
+	ws.WriteJSON(frames[2])
+	replies := make([]map[string]interface{}, 0)
+	if err := ws.ReadJSON(&replies); err != nil {
+		t.Fatalf("Third Reply Not Received: %s", err)
+	}
+	if len(replies) != 1 || replies[0]["id"] != "3" || replies[0]["successful"] != false {
+		t.Errorf("Unexpected Third Replies %v", replies)
+	}
+	if _, _, err := ws.ReadMessage(); !websocket.IsCloseError(err, CLOSE_POLICY_VIOLATION) {
+		t.Errorf("Expected Policy Violation Close, got %v", err)
+	}
+	if server.GetClient(firstClientId(server)) != nil {
+		t.Error("Session Was Not Dropped")
+	}
+}
+
+func firstClientId(server Server) string {
+	bs := server.(*bayeuxServer)
+	bs.clientMutex.Lock()
+	defer bs.clientMutex.Unlock()
+
+	for id := range bs.clients {
+		return id
+	}
+	return ""
+}
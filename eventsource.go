@@ -0,0 +1,210 @@
+package bayeux
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type eventSourceClient struct {
+	resp        http.ResponseWriter
+	flusher     http.Flusher
+	writeLock   *sync.Mutex
+	closeOnce   *sync.Once
+	stopped     chan struct{}
+	closing     chan struct{}
+	closingOnce *sync.Once
+	baseClient
+}
+
+func NewEventSourceClient(id string, resp http.ResponseWriter, server Server) Client {
+	flusher, _ := resp.(http.Flusher)
+
+	client := &eventSourceClient{
+		resp,
+		flusher,
+		&sync.Mutex{},
+		&sync.Once{},
+		make(chan struct{}),
+		make(chan struct{}),
+		&sync.Once{},
+		newBaseClient(id, server),
+	}
+	client.self = client
+
+	go client.OutgoingLoop()
+
+	return client
+}
+
+func (c *eventSourceClient) Wait() {
+	<-c.done
+}
+
+func (c *eventSourceClient) Close() error {
+	c.closeOnce.Do(func() {
+		c.baseClient.Close()
+		c.GetLogger().Println("Client Disconnected")
+		close(c.done)
+	})
+
+	return nil
+}
+
+// WriteEvent writes one event to the stream. It is safe to call alongside
+// the outgoing loop.
+func (c *eventSourceClient) WriteEvent(event string, data []byte) error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	var err error
+	if event != "" {
+		_, err = fmt.Fprintf(c.resp, "event: %s\n", event)
+	}
+	if err == nil {
+		_, err = fmt.Fprintf(c.resp, "data: %s\n\n", data)
+	}
+	if err == nil && c.flusher != nil {
+		c.flusher.Flush()
+	}
+
+	return err
+}
+
+// closeAfterFlush closes the stream once the messages already queued have
+// been written. Event streams carry no close code.
+func (c *eventSourceClient) closeAfterFlush(code int) {
+	c.closingOnce.Do(func() {
+		close(c.closing)
+	})
+}
+
+// writeQueued writes frames until the queue is empty. It returns false if
+// the stream failed and the client was closed.
+func (c *eventSourceClient) writeQueued() bool {
+	for {
+		frame, batch := c.nextBatch(c.done)
+		if batch == nil {
+			return true
+		}
+
+		if err := c.WriteEvent("", frame); err != nil {
+			c.Close()
+			return false
+		}
+	}
+}
+
+func (c *eventSourceClient) OutgoingLoop() {
+	defer close(c.stopped)
+
+	// Without connect holds the stream can idle for up to maxInterval.
+	period := c.config.timeout
+	if period <= 0 {
+		period = c.config.maxInterval
+	}
+
+	keepAlive := time.NewTicker(time.Duration(period) * time.Millisecond / 2)
+	defer keepAlive.Stop()
+
+	for {
+		if !c.writeQueued() {
+			return
+		}
+
+		select {
+		case <-c.queue.Ready():
+		case <-c.closing:
+			if c.writeQueued() {
+				c.Close()
+			}
+			return
+		case <-keepAlive.C:
+			// Comment lines keep intermediaries from timing out the stream.
+			c.writeLock.Lock()
+			_, err := fmt.Fprint(c.resp, ":\n\n")
+			if err == nil && c.flusher != nil {
+				c.flusher.Flush()
+			}
+			c.writeLock.Unlock()
+			if err != nil {
+				c.Close()
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// ServeEventSource opens a Server-Sent Events stream for a new client. The
+// first event, named "open", carries the id the client must pass as the
+// "stream" query parameter when POSTing messages.
+func (bs *bayeuxServer) ServeEventSource(resp http.ResponseWriter, req *http.Request) {
+	if _, ok := resp.(http.Flusher); !ok {
+		http.Error(resp, "Streaming Not Supported", http.StatusInternalServerError)
+		return
+	}
+
+	resp.Header().Set("Content-Type", "text/event-stream")
+	resp.Header().Set("Cache-Control", "no-cache")
+	resp.Header().Set("Connection", "keep-alive")
+	resp.WriteHeader(http.StatusOK)
+
+	client := NewEventSourceClient(GenerateNewClientId(), resp, bs).(*eventSourceClient)
+
+	// Registered first, the client may POST as soon as it learns its id.
+	bs.RegisterClient(client.GetId(), client)
+
+	if err := client.WriteEvent("open", []byte(client.GetId())); err != nil {
+		client.Close()
+		<-client.stopped
+		return
+	}
+
+	select {
+	case <-client.done:
+	case <-req.Context().Done():
+		client.Close()
+	}
+
+	// The response writer must not be touched once this handler returns.
+	<-client.stopped
+}
+
+// ServeEventSourcePost accepts client to server messages for an open
+// stream. Replies are delivered on the stream, not in the POST response.
+func (bs *bayeuxServer) ServeEventSourcePost(resp http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		http.Error(resp, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	client, ok := bs.GetClient(req.URL.Query().Get("stream")).(*eventSourceClient)
+	if !ok {
+		http.Error(resp, "Unknown Stream", http.StatusBadRequest)
+		return
+	}
+
+	msgs := make([]map[string]interface{}, 0)
+	err := ParseReqBody(req.Body, &msgs)
+	if err != nil {
+		http.Error(resp, "Parse Error, bad request", http.StatusBadRequest)
+		return
+	}
+
+	for _, msg := range msgs {
+		payload, err := json.Marshal(msg)
+		if err != nil {
+			http.Error(resp, "Parse Error, bad request", http.StatusBadRequest)
+			return
+		}
+
+		ch, _ := msg["channel"].(string)
+		client.OnMessage(ch, payload)
+	}
+
+	resp.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,79 @@
+package bayeux
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func readEvent(t *testing.T, r *bufio.Reader) (string, string) {
+	var event, data string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		line = strings.TrimRight(line, "\n")
+
+		switch {
+		case line == "":
+			if data != "" {
+				return event, data
+			}
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+func TestEventSourceHandshake(t *testing.T) {
+	server := Handler()
+	defer server.Close()
+
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	req, _ := http.NewRequest("GET", ts.URL, nil)
+	req.Header.Set("Accept", "text/event-stream")
+	stream, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Body.Close()
+
+	events := bufio.NewReader(stream.Body)
+	event, streamId := readEvent(t, events)
+	if event != "open" || streamId == "" {
+		t.Fatalf("Unexpected Open Event %q %q", event, streamId)
+	}
+	if server.GetClient(streamId) == nil {
+		t.Fatal("Stream Announced Before It Was Registered")
+	}
+
+	body, _ := json.Marshal([]map[string]interface{}{
+		{"channel": "/meta/handshake", "version": "1.0", "supportedConnectionTypes": []string{CLIENT_SSE}, "id": "1"},
+	})
+	resp, err := http.Post(ts.URL+"?stream="+streamId, "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("Unexpected Status %d", resp.StatusCode)
+	}
+
+	_, data := readEvent(t, events)
+	replies := make([]map[string]interface{}, 0)
+	if err := json.Unmarshal([]byte(data), &replies); err != nil {
+		t.Fatal(err)
+	}
+	if len(replies) != 1 || replies[0]["clientId"] != streamId || replies[0]["successful"] != true {
+		t.Errorf("Unexpected Replies %v", replies)
+	}
+}
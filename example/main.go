@@ -7,6 +7,7 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"time"
 
 	bayeux "github.com/ebittleman/go-bayeux"
 )
@@ -26,7 +27,15 @@ func main() {
 	mux := http.NewServeMux()
 
 	mux.HandleFunc("/", rootHandler)
-	mux.Handle("/ws/cometd", bayeux.Handler())
+	bayeuxHandler := bayeux.Handler(
+		bayeux.WithLogger(logger),
+		bayeux.WithExtension(bayeux.NewAckExtension()),
+		bayeux.WithExtension(bayeux.NewTimesyncExtension()),
+		// Paired with the resume and reload extensions in static/src.
+		bayeux.WithResumeGracePeriod(30*time.Second),
+	)
+	mux.Handle("/ws/cometd", bayeuxHandler)
+	mux.Handle("/ws/cometd/", bayeuxHandler)
 
 	logger.Printf("Starting webserver on %s", listenAddr)
 	err = http.ListenAndServe(listenAddr, mux)
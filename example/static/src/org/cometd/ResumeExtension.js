@@ -0,0 +1,90 @@
+/*
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+(function()
+{
+    function bind(org_cometd)
+    {
+        /**
+         * This client-side extension lets a websocket client reattach to its
+         * session from a new connection, when the server keeps sessions for a
+         * resume grace period.
+         * The server hands a resume token to websocket clients in the ext of a
+         * successful handshake. The token is sent back in the ext of every
+         * /meta/connect, so that the first one on a new connection resumes the
+         * session instead of failing with an unknown client.
+         * Combined with the reload extension, whose replayed handshake response
+         * carries the token, sessions also survive page reloads.
+         */
+        return org_cometd.ResumeExtension = function()
+        {
+            var _cometd;
+            var _token = null;
+
+            function _debug(text, args)
+            {
+                _cometd._debug(text, args);
+            }
+
+            this.registered = function(name, cometd)
+            {
+                _cometd = cometd;
+                _debug('ResumeExtension: executing registration callback');
+            };
+
+            this.unregistered = function()
+            {
+                _debug('ResumeExtension: executing unregistration callback');
+                _cometd = null;
+            };
+
+            this.incoming = function(message)
+            {
+                var channel = message.channel;
+                if (channel == '/meta/handshake')
+                {
+                    _token = message.successful && message.ext && message.ext.resume || null;
+                    _debug('ResumeExtension: server sent resume token', _token);
+                }
+                else if (channel == '/meta/disconnect' && message.successful)
+                {
+                    _token = null;
+                }
+                return message;
+            };
+
+            this.outgoing = function(message)
+            {
+                if (message.channel == '/meta/connect' && _token)
+                {
+                    if (!message.ext)
+                    {
+                        message.ext = {};
+                    }
+                    message.ext.resume = _token;
+                }
+                return message;
+            };
+        };
+    }
+
+    if (typeof define === 'function' && define.amd)
+    {
+        define(['org/cometd'], bind);
+    }
+    else
+    {
+        bind(org.cometd);
+    }
+})();
@@ -1,7 +1,10 @@
 define([
     'exports',
-    'dojox/cometd'
-], function(wstest, cometd) {
+    'dojo/on',
+    'dojox/cometd',
+    'dojox/cometd/reload',
+    'dojox/cometd/resume'
+], function(wstest, on, cometd) {
     var config = {
         contextPath: '/ws'
     };
@@ -12,6 +15,12 @@ define([
             logLevel: 'info'
         });
 
+        // Saves the session so the reloaded page resumes it, see
+        // WithResumeGracePeriod.
+        on(window, 'beforeunload', function() {
+            cometd.reload();
+        });
+
 
 
         cometd.handshake(function(handshakeReply) {
@@ -0,0 +1,146 @@
+package bayeux
+
+import (
+	"encoding/json"
+
+	"github.com/ebittleman/go-bayeux/messages"
+)
+
+// ServerExtension hooks into every message a client sends or receives, in
+// the generic JSON form of the message. Extensions may inspect or modify the
+// message, typically its "ext" field, or drop it by returning false.
+//
+// Extensions added to the Server see every client's messages. Extensions
+// added to a Client only see that session's. Incoming messages pass through
+// the server's extensions first, outgoing through the session's first.
+type ServerExtension interface {
+	Incoming(client Client, msg map[string]interface{}) bool
+	Outgoing(client Client, msg map[string]interface{}) bool
+}
+
+// EncodedExtension is implemented by extensions that can take a broadcast
+// in its encoded form without modifying it. When every extension a message
+// passes through implements it, the bytes shared by all subscribers are
+// delivered as they are instead of being decoded and re-encoded per session.
+type EncodedExtension interface {
+	OutgoingEncoded(client Client, msg messages.Encoded) bool
+}
+
+// extendEncoded runs msg through exts if they all take encoded messages,
+// handled is false otherwise.
+func extendEncoded(client Client, msg messages.Encoded, exts ...[]ServerExtension) (handled bool, ok bool) {
+	for _, group := range exts {
+		for _, ext := range group {
+			if _, ok := ext.(EncodedExtension); !ok {
+				return false, false
+			}
+		}
+	}
+
+	for _, group := range exts {
+		for _, ext := range group {
+			if !ext.(EncodedExtension).OutgoingEncoded(client, msg) {
+				return true, false
+			}
+		}
+	}
+
+	return true, true
+}
+
+// addExtension registers ext for every client.
+func (bs *bayeuxServer) addExtension(ext ServerExtension) {
+	bs.extensions = append(bs.extensions, ext)
+}
+
+// AddExtension registers ext for this session only.
+func (c *baseClient) AddExtension(ext ServerExtension) {
+	c.lock.Lock()
+	c.extensions = append(c.extensions, ext)
+	c.lock.Unlock()
+}
+
+func (c *baseClient) GetExtensions() []ServerExtension {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.extensions
+}
+
+// ExtendIncoming runs a raw message received from client through the
+// extensions. It returns false if an extension dropped the message.
+func ExtendIncoming(bs Server, client Client, msg *messages.RawMessage) (bool, error) {
+	serverExts := configOf(bs).extensions
+	sessionExts := client.GetExtensions()
+	if len(serverExts) == 0 && len(sessionExts) == 0 {
+		return true, nil
+	}
+
+	generic := make(map[string]interface{})
+	if err := json.Unmarshal(msg.Payload, &generic); err != nil {
+		return false, err
+	}
+
+	for _, ext := range serverExts {
+		if !ext.Incoming(client, generic) {
+			return false, nil
+		}
+	}
+	for _, ext := range sessionExts {
+		if !ext.Incoming(client, generic) {
+			return false, nil
+		}
+	}
+
+	payload, err := json.Marshal(generic)
+	if err != nil {
+		return false, err
+	}
+
+	msg.Channel, _ = generic["channel"].(string)
+	msg.Payload = payload
+
+	return true, nil
+}
+
+// ExtendOutgoing runs a message about to be sent to client through the
+// extensions. Without extensions, or with only EncodedExtensions for an
+// encoded broadcast, msg is returned untouched, otherwise a copy in its
+// generic form is extended. It returns false if an extension dropped the
+// message.
+func ExtendOutgoing(bs Server, client Client, msg messages.Message) (messages.Message, bool) {
+	serverExts := configOf(bs).extensions
+	sessionExts := client.GetExtensions()
+	if len(serverExts) == 0 && len(sessionExts) == 0 {
+		return msg, true
+	}
+
+	if encoded, isEncoded := msg.(messages.Encoded); isEncoded {
+		if handled, ok := extendEncoded(client, encoded, sessionExts, serverExts); handled {
+			return msg, ok
+		}
+	}
+
+	// Maps are copied too, the caller may be sending the same one to other
+	// sessions.
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		bs.GetLogger().Printf("Can't Extend Outgoing Message: %s\n", err)
+		return msg, true
+	}
+
+	generic := make(map[string]interface{})
+	json.Unmarshal(payload, &generic)
+
+	for _, ext := range sessionExts {
+		if !ext.Outgoing(client, generic) {
+			return nil, false
+		}
+	}
+	for _, ext := range serverExts {
+		if !ext.Outgoing(client, generic) {
+			return nil, false
+		}
+	}
+
+	return generic, true
+}
@@ -0,0 +1,171 @@
+package bayeux
+
+import (
+	"testing"
+
+	"github.com/ebittleman/go-bayeux/messages"
+)
+
+type testExtension struct {
+	incoming func(Client, map[string]interface{}) bool
+	outgoing func(Client, map[string]interface{}) bool
+}
+
+func (e *testExtension) Incoming(client Client, msg map[string]interface{}) bool {
+	if e.incoming == nil {
+		return true
+	}
+	return e.incoming(client, msg)
+}
+
+func (e *testExtension) Outgoing(client Client, msg map[string]interface{}) bool {
+	if e.outgoing == nil {
+		return true
+	}
+	return e.outgoing(client, msg)
+}
+
+func TestServerExtensionModifiesMessages(t *testing.T) {
+	server := Handler()
+	defer server.Close()
+	bs := server.(*bayeuxServer)
+
+	clientId := longPollHandshake(t, server, CLIENT_LONGPOLL).ClientId
+
+	seen := make([]Client, 0)
+	bs.addExtension(&testExtension{
+		func(client Client, msg map[string]interface{}) bool {
+			seen = append(seen, client)
+			if msg["channel"] == "/meta/subscribe" {
+				msg["subscription"] = "/renamed"
+			}
+			return true
+		},
+		func(client Client, msg map[string]interface{}) bool {
+			seen = append(seen, client)
+			msg["ext"] = map[string]interface{}{"seen": true}
+			return true
+		},
+	})
+
+	replies, _ := bs.HandleLongPoll([]map[string]interface{}{
+		{"channel": "/meta/subscribe", "clientId": clientId, "subscription": "/original"},
+	})
+
+	// The subscribe reply, then the welcome broadcast on the subscribed
+	// channel, which is delivered synchronously.
+	if len(replies) != 2 {
+		t.Fatalf("Expected Two Replies, got %v", replies)
+	}
+	if welcome := replies[1].(map[string]interface{}); welcome["channel"] != "/renamed" {
+		t.Errorf("Expected Welcome Message Second, got %v", welcome)
+	}
+
+	reply := replies[0].(map[string]interface{})
+	if reply["subscription"] != "/renamed" {
+		t.Errorf("Incoming Message Not Modified: %v", reply)
+	}
+	if ext, _ := reply["ext"].(map[string]interface{}); ext["seen"] != true {
+		t.Errorf("Outgoing Message Not Modified: %v", reply)
+	}
+	if server.GetChannels().Get("/renamed") == nil {
+		t.Error("Modified Subscription Not Applied")
+	}
+	for _, client := range seen {
+		if client != server.GetClient(clientId) {
+			t.Errorf("Extension Given %T, not the transport client", client)
+		}
+	}
+}
+
+func TestSessionExtensionDropsMessages(t *testing.T) {
+	server := Handler()
+	defer server.Close()
+	bs := server.(*bayeuxServer)
+
+	clientId := longPollHandshake(t, server, CLIENT_LONGPOLL).ClientId
+	other := longPollHandshake(t, server, CLIENT_LONGPOLL).ClientId
+
+	server.GetClient(clientId).AddExtension(&testExtension{
+		func(client Client, msg map[string]interface{}) bool {
+			return msg["channel"] != "/meta/subscribe"
+		},
+		nil,
+	})
+
+	replies, _ := bs.HandleLongPoll([]map[string]interface{}{
+		{"channel": "/meta/subscribe", "clientId": clientId, "subscription": "/dropped"},
+	})
+	if len(replies) != 0 || server.GetChannels().Get("/dropped") != nil {
+		t.Errorf("Incoming Message Not Dropped: %v", replies)
+	}
+
+	replies, _ = bs.HandleLongPoll([]map[string]interface{}{
+		{"channel": "/meta/subscribe", "clientId": other, "subscription": "/kept"},
+	})
+	if len(replies) != 2 || server.GetChannels().Get("/kept") == nil {
+		t.Fatalf("Other Session Affected By Extension: %v", replies)
+	}
+	if _, ok := replies[0].(*messages.SubscribeResponse); !ok {
+		t.Errorf("Expected Subscribe Reply First, got %v", replies)
+	}
+}
+
+func TestEncodedExtensionsKeepBroadcastsEncoded(t *testing.T) {
+	server := Handler()
+	defer server.Close()
+	bs := server.(*bayeuxServer)
+	clientId := longPollHandshake(t, server, CLIENT_LONGPOLL).ClientId
+
+	bs.addExtension(NewAckExtension())
+	bs.addExtension(NewTimesyncExtension())
+	bs.HandleLongPoll([]map[string]interface{}{
+		{"channel": "/meta/subscribe", "clientId": clientId, "subscription": "/prices"},
+	})
+
+	server.Publish("/prices", map[string]interface{}{"channel": "/prices", "data": 1})
+
+	queued := server.GetClient(clientId).(*longPollClient).Flush(false)
+	if len(queued) != 1 {
+		t.Fatalf("Expected One Message, got %v", queued)
+	}
+	if _, ok := queued[0].(messages.Encoded); !ok {
+		t.Errorf("Broadcast Was Decoded For The Session: %T", queued[0])
+	}
+}
+
+func TestOutgoingExtensionsGetTheirOwnCopy(t *testing.T) {
+	server := Handler()
+	defer server.Close()
+	bs := server.(*bayeuxServer)
+
+	first := longPollHandshake(t, server, CLIENT_LONGPOLL).ClientId
+	second := longPollHandshake(t, server, CLIENT_LONGPOLL).ClientId
+
+	bs.addExtension(&testExtension{
+		nil,
+		func(client Client, msg map[string]interface{}) bool {
+			if ext, ok := msg["ext"].(map[string]interface{}); ok {
+				ext["to"] = client.(*longPollClient).GetId()
+			}
+			return true
+		},
+	})
+
+	msg := map[string]interface{}{"channel": "/chat", "data": "hi", "ext": map[string]interface{}{}}
+	server.Deliver(first, msg)
+	server.Deliver(second, msg)
+
+	for _, clientId := range []string{first, second} {
+		queued := server.GetClient(clientId).(*longPollClient).Flush(false)
+		if len(queued) != 1 {
+			t.Fatalf("Expected One Message, got %v", queued)
+		}
+		if ext := queued[0].(map[string]interface{})["ext"].(map[string]interface{}); ext["to"] != clientId {
+			t.Errorf("Message Shared Between Sessions: %v", ext)
+		}
+	}
+	if len(msg["ext"].(map[string]interface{})) != 0 {
+		t.Errorf("Caller's Message Modified: %v", msg)
+	}
+}
@@ -0,0 +1,5 @@
+module github.com/ebittleman/go-bayeux
+
+go 1.21
+
+require github.com/gorilla/websocket v1.5.3
@@ -1,42 +1,181 @@
 package bayeux
 
-// func (bs *bayeuxServer) Bind(path string) {
-//  http.Handle(path)
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
 
-// http.HandleFunc(path+"/handshake", func(resp http.ResponseWriter, req *http.Request) {
-//  client := NewLongPollClient(GenerateNewClientId(), resp, req, bs)
-//  bs.RegisterClient(client.GetId(), client)
+	"github.com/ebittleman/go-bayeux/messages"
+)
 
-//  msgs := []*messages.HandshakeRequest{}
+type longPollClient struct {
+	connectReply interface{}
+	replyLock    *sync.Mutex
+	closeOnce    *sync.Once
+	baseClient
+}
 
-//  err := ParseReqBody(req.Body, &msgs)
-//  if err != nil {
-//      http.Error(resp, "Parse Error, bad request", 406)
-//      return
-//  }
+func NewLongPollClient(id string, server Server) Client {
+	client := &longPollClient{
+		nil,
+		&sync.Mutex{},
+		&sync.Once{},
+		newBaseClient(id, server),
+	}
+	client.self = client
 
-//  handshakeRequest := msgs[0]
+	return client
+}
 
-//  Handshake(bs, client.GetId(), handshakeRequest)
-// })
+// SendMessage queues msg until the next poll picks it up. Replies to
+// /meta/connect are kept aside so that they are only released by the
+// request that is holding the connect, and are only extended once that
+// request flushes, see Flush.
+func (c *longPollClient) SendMessage(msg messages.Message) {
+	c.replyLock.Lock()
+	defer c.replyLock.Unlock()
 
-// http.HandleFunc(path+"/connect", func(resp http.ResponseWriter, req *http.Request) {
-//  msgs := []*messages.ConnectRequest{}
+	if _, connectReply := msg.(*messages.ConnectResponse); connectReply {
+		c.connectReply = msg
+		return
+	}
 
-//  err := ParseReqBody(req.Body, &msgs)
-//  if err != nil {
-//      http.Error(resp, "Parse Error, bad request", 406)
-//      return
-//  }
+	msg, ok := ExtendOutgoing(c.server, c, msg)
+	if ok {
+		c.enqueue(msg)
+	}
+}
 
-//  connectRequest := msgs[0]
+func (c *longPollClient) Close() error {
+	c.closeOnce.Do(func() {
+		c.baseClient.Close()
+		c.GetLogger().Println("Client Disconnected")
+		close(c.done)
+	})
 
-//  //TODO Implement Connect
+	return nil
+}
 
-//  Connect(bs, connectRequest)
+func (c *longPollClient) Wait() {
+	<-c.done
+}
 
-// })
-// http.HandleFunc(path+"/", func(resp http.ResponseWriter, req *http.Request) {
-//  <-time.After(time.Minute)
-// })
-// }
+// Flush empties the queue, appending the pending connect reply last when
+// withConnect is set. The connect reply goes through the extensions while
+// no other message can be queued, so that extensions closing a batch on it,
+// like the ack extension, see exactly the messages sent along with it.
+func (c *longPollClient) Flush(withConnect bool) []interface{} {
+	c.replyLock.Lock()
+	defer c.replyLock.Unlock()
+
+	var reply messages.Message
+	ok := false
+	if withConnect && c.connectReply != nil {
+		reply, ok = ExtendOutgoing(c.server, c, c.connectReply)
+		c.connectReply = nil
+	}
+
+	msgs := make([]interface{}, 0)
+	for _, msg := range c.queue.Drain() {
+		msgs = append(msgs, msg)
+	}
+	if ok {
+		msgs = append(msgs, reply)
+	}
+
+	return msgs
+}
+
+// Hold blocks until a message is queued, the timeout expires or the
+// client is closed. Unlike streaming transports a polling client can only
+// receive messages once its connect is released.
+func (c *longPollClient) Hold(timeout time.Duration) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for c.queue.Len() == 0 {
+		select {
+		case <-c.queue.Ready():
+		case <-timer.C:
+			return
+		case <-c.done:
+			return
+		}
+	}
+}
+
+func (bs *bayeuxServer) ServeLongPoll(resp http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		http.Error(resp, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	msgs := make([]map[string]interface{}, 0)
+	err := ParseReqBody(req.Body, &msgs)
+	if err != nil || len(msgs) == 0 {
+		http.Error(resp, "Parse Error, bad request", http.StatusBadRequest)
+		return
+	}
+
+	replies, err := bs.HandleLongPoll(msgs)
+	if err != nil {
+		http.Error(resp, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	output, err := EncodeBatch(replies)
+	if err != nil {
+		http.Error(resp, "Error Formatting Response", http.StatusInternalServerError)
+		return
+	}
+
+	resp.Header().Set("Content-Type", "application/json;charset=UTF-8")
+	resp.Write(output)
+}
+
+// HandleLongPoll routes a batch of decoded messages for a polling transport
+// and returns the replies to write back. A batch containing /meta/connect is
+// held by Connect until messages are queued for the client or the advised
+// timeout expires.
+func (bs *bayeuxServer) HandleLongPoll(msgs []map[string]interface{}) ([]interface{}, error) {
+	var client *longPollClient
+
+	first, _ := msgs[0]["channel"].(string)
+	if first == "/meta/handshake" {
+		client = NewLongPollClient(GenerateNewClientId(), bs).(*longPollClient)
+		bs.RegisterClient(client.GetId(), client)
+	} else {
+		clientId, _ := msgs[0]["clientId"].(string)
+		client, _ = bs.GetClient(clientId).(*longPollClient)
+	}
+
+	if client == nil {
+		return []interface{}{&messages.ConnectResponse{
+			first,
+			false,
+			NewError(402, "Unknown client").Error(),
+			"",
+			NewTimestamp().String(),
+			"",
+			&messages.ConnectAdvice{RECONNECT_HANDSHAKE, 0, 0, 0},
+		}}, nil
+	}
+
+	connect := false
+	for _, msg := range msgs {
+		payload, err := json.Marshal(msg)
+		if err != nil {
+			return nil, err
+		}
+
+		ch, _ := msg["channel"].(string)
+		if ch == "/meta/connect" {
+			connect = true
+		}
+
+		RouteIncomingMsg(bs, messages.RawMessage{ch, client.GetId(), payload})
+	}
+
+	return client.Flush(connect), nil
+}
@@ -0,0 +1,110 @@
+package bayeux
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ebittleman/go-bayeux/messages"
+)
+
+func postMessages(t *testing.T, server Server, msgs []map[string]interface{}) []map[string]interface{} {
+	body, _ := json.Marshal(msgs)
+	req := httptest.NewRequest("POST", "/cometd", bytes.NewReader(body))
+	resp := httptest.NewRecorder()
+
+	server.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Unexpected Status %d: %s", resp.Code, resp.Body.String())
+	}
+
+	replies := make([]map[string]interface{}, 0)
+	if err := json.Unmarshal(resp.Body.Bytes(), &replies); err != nil {
+		t.Fatal(err)
+	}
+
+	return replies
+}
+
+func TestLongPollHandshake(t *testing.T) {
+	server := Handler()
+	defer server.Close()
+
+	replies := postMessages(t, server, []map[string]interface{}{
+		{"channel": "/meta/handshake", "version": "1.0", "supportedConnectionTypes": []string{CLIENT_LONGPOLL}, "id": "1"},
+	})
+
+	if len(replies) != 1 || replies[0]["channel"] != "/meta/handshake" {
+		t.Fatalf("Unexpected Replies %v", replies)
+	}
+
+	clientId, _ := replies[0]["clientId"].(string)
+	if server.GetClient(clientId) == nil {
+		t.Error("Client Was Not Registered")
+	}
+}
+
+func longPollConnect(bs *bayeuxServer, clientId string, timeout int) ([]interface{}, time.Duration) {
+	start := time.Now()
+	replies, _ := bs.HandleLongPoll([]map[string]interface{}{
+		{"channel": "/meta/connect", "clientId": clientId, "connectionType": CLIENT_LONGPOLL, "advice": map[string]int{"timeout": timeout}},
+	})
+
+	return replies, time.Since(start)
+}
+
+func TestLongPollConnectHold(t *testing.T) {
+	server := Handler()
+	defer server.Close()
+
+	bs := server.(*bayeuxServer)
+	clientId := longPollHandshake(t, server, CLIENT_LONGPOLL).ClientId
+
+	replies, elapsed := longPollConnect(bs, clientId, 1000)
+	if elapsed >= time.Second {
+		t.Error("First Connect Was Held")
+	}
+
+	replies, elapsed = longPollConnect(bs, clientId, 50)
+	if elapsed < 50*time.Millisecond {
+		t.Error("Connect Was Not Held")
+	}
+	if len(replies) != 1 {
+		t.Fatalf("Unexpected Replies %v", replies)
+	}
+
+	reply := replies[0].(*messages.ConnectResponse)
+	if !reply.Successful || reply.Advice.Reconnect != RECONNECT_RETRY || reply.Advice.Timeout != defaultTimeout {
+		t.Errorf("Unexpected Reply %v", reply)
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		server.GetClient(clientId).SendMessage(&messages.EventMessage{"/foo", "bar", ""})
+	}()
+
+	replies, elapsed = longPollConnect(bs, clientId, 1000)
+	if elapsed >= time.Second {
+		t.Error("Connect Was Not Released By Queued Message")
+	}
+	if len(replies) != 2 {
+		t.Fatalf("Unexpected Replies %v", replies)
+	}
+}
+
+func TestLongPollUnknownClient(t *testing.T) {
+	server := Handler()
+	defer server.Close()
+
+	replies := postMessages(t, server, []map[string]interface{}{
+		{"channel": "/meta/connect", "clientId": "nobody", "connectionType": CLIENT_LONGPOLL},
+	})
+
+	if len(replies) != 1 || replies[0]["successful"] != false {
+		t.Fatalf("Unexpected Replies %v", replies)
+	}
+}
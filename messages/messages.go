@@ -1,7 +1,28 @@
 package messages
 
+import (
+	"encoding/json"
+)
+
 type Message interface{}
 
+// Encoded is a message already serialized to JSON, so that a broadcast is
+// encoded once and its bytes shared by every session it is delivered to.
+type Encoded []byte
+
+func (e Encoded) MarshalJSON() ([]byte, error) {
+	return e, nil
+}
+
+// Encode serializes m unless it already is.
+func Encode(m Message) (Encoded, error) {
+	if encoded, ok := m.(Encoded); ok {
+		return encoded, nil
+	}
+
+	return json.Marshal(m)
+}
+
 type RawMessage struct {
 	Channel  string
 	ClientId string
@@ -17,12 +38,14 @@ type HandshakeRequest struct {
 		Timeout  int `json:"timeout"`
 		Interval int `json:"interval"`
 	} `json:"advice"`
-	Id string `json:"id,omitempty"`
+	Id  string                 `json:"id,omitempty"`
+	Ext map[string]interface{} `json:"ext,omitempty"`
 }
 
 type HandshakeResponseAdvice struct {
-	Reconnect string `json:"reconnect"`
-	Interval  int    `json:"interval,omitempty"`
+	Reconnect   string `json:"reconnect"`
+	Interval    int    `json:"interval,omitempty"`
+	MaxInterval int    `json:"maxInterval,omitempty"`
 }
 
 type HandshakeResponse struct {
@@ -36,18 +59,27 @@ type HandshakeResponse struct {
 	Error                    string                   `json:"error,omitempty"`
 	Id                       string                   `json:"id,omitempty"`
 	Advice                   *HandshakeResponseAdvice `json:"advice,omitempty"`
+	Ext                      map[string]interface{}   `json:"ext,omitempty"`
+}
+
+type ConnectRequestAdvice struct {
+	Timeout  *int `json:"timeout,omitempty"`
+	Interval *int `json:"interval,omitempty"`
 }
 
 type ConnectRequest struct {
-	Channel        string `json:"channel"`
-	ClientId       string `json:"clientId"`
-	ConnectionType string `json:"connectionType"`
-	Id             string `json:"id,omitempty"`
+	Channel        string                `json:"channel"`
+	ClientId       string                `json:"clientId"`
+	ConnectionType string                `json:"connectionType"`
+	Id             string                `json:"id,omitempty"`
+	Advice         *ConnectRequestAdvice `json:"advice,omitempty"`
 }
 
 type ConnectAdvice struct {
-	Reconnect string `json:"reconnect"`
-	Interval  int    `json:"interval"`
+	Reconnect   string `json:"reconnect"`
+	Interval    int    `json:"interval"`
+	Timeout     int    `json:"timeout,omitempty"`
+	MaxInterval int    `json:"maxInterval,omitempty"`
 }
 
 type ConnectResponse struct {
@@ -74,10 +106,11 @@ type DisconnectResponse struct {
 }
 
 type SubscribeRequest struct {
-	Channel      string `json:"channel"`
-	ClientId     string `json:"clientId"`
-	Subscription string `json:"subscription"`
-	Id           string `json:"id,omitempty"`
+	Channel      string                 `json:"channel"`
+	ClientId     string                 `json:"clientId"`
+	Subscription string                 `json:"subscription"`
+	Id           string                 `json:"id,omitempty"`
+	Ext          map[string]interface{} `json:"ext,omitempty"`
 }
 
 type SubscribeResponse struct {
@@ -94,10 +127,11 @@ type UnsubscribeRequest SubscribeRequest
 type UnsubscribeResponse SubscribeResponse
 
 type PublishRequest struct {
-	Channel  string      `json:"channel"`
-	Data     interface{} `json:"data"`
-	ClientId string      `json:"clientId"`
-	Id       string      `json:"id,omitempty"`
+	Channel  string                 `json:"channel"`
+	Data     interface{}            `json:"data"`
+	ClientId string                 `json:"clientId"`
+	Id       string                 `json:"id,omitempty"`
+	Ext      map[string]interface{} `json:"ext,omitempty"`
 }
 
 type PublishResponse struct {
@@ -112,3 +146,38 @@ type EventMessage struct {
 	Data    interface{} `json:"data"`
 	Id      string      `json:"id,omitempty"`
 }
+
+type ServiceRequest struct {
+	Channel  string                 `json:"channel"`
+	Data     json.RawMessage        `json:"data"`
+	ClientId string                 `json:"clientId"`
+	Id       string                 `json:"id,omitempty"`
+	Ext      map[string]interface{} `json:"ext,omitempty"`
+}
+
+// Decode unmarshals the request's data into v.
+func (r *ServiceRequest) Decode(v interface{}) error {
+	if len(r.Data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(r.Data, v)
+}
+
+type ServiceResponse struct {
+	Channel    string      `json:"channel"`
+	Successful bool        `json:"successful"`
+	Error      string      `json:"error,omitempty"`
+	Data       interface{} `json:"data,omitempty"`
+	Id         string      `json:"id,omitempty"`
+}
+
+// ErrorResponse is a generic unsuccessful reply for messages whose own reply
+// type can not be built, e.g. because the request could not be decoded.
+type ErrorResponse struct {
+	Channel    string         `json:"channel"`
+	Successful bool           `json:"successful"`
+	Error      string         `json:"error"`
+	ClientId   string         `json:"clientId,omitempty"`
+	Id         string         `json:"id,omitempty"`
+	Advice     *ConnectAdvice `json:"advice,omitempty"`
+}
@@ -0,0 +1,194 @@
+package bayeux
+
+import (
+	"log"
+	"time"
+)
+
+// Option configures a server created by Handler.
+type Option func(*bayeuxServer)
+
+// config holds the settings chosen through Options. Clients share their
+// server's, it is not modified once the server is serving.
+type config struct {
+	websocketUpgrader WebSocketUpgrader
+	transports        []string
+	securityPolicy    SecurityPolicy
+	authenticator     Authenticator
+	sessionListeners  []SessionListener
+	violationLimit    int
+	extensions        []ServerExtension
+	resumeGrace       time.Duration
+	resumeKey         []byte
+	queueLimit        int
+	overflowPolicy    int
+	overflowListeners []OverflowListener
+	batchWindow       time.Duration
+	maxBatchSize      int
+	maxBatchBytes     int
+	interval          int
+	timeout           int
+	maxInterval       int
+	logger            *log.Logger
+}
+
+func newConfig() *config {
+	return &config{
+		NewWebSocketUpgrader(DefaultWebSocketOptions),
+		supportedClients,
+		DefaultSecurityPolicy,
+		nil,
+		make([]SessionListener, 0),
+		defaultViolationLimit,
+		make([]ServerExtension, 0),
+		defaultResumeGrace,
+		newResumeKey(),
+		defaultQueueLimit,
+		defaultOverflowPolicy,
+		make([]OverflowListener, 0),
+		defaultBatchWindow,
+		defaultMaxBatchSize,
+		defaultMaxBatchBytes,
+		defaultInterval,
+		defaultTimeout,
+		defaultMaxInterval,
+		logger,
+	}
+}
+
+// configOf returns the settings of bs, or the defaults for servers
+// implemented outside this package.
+func configOf(bs Server) *config {
+	if server, ok := bs.(*bayeuxServer); ok {
+		return server.config
+	}
+
+	return newConfig()
+}
+
+func millisOf(d time.Duration) int {
+	return int(d / time.Millisecond)
+}
+
+// WithTimeout sets how long a /meta/connect is held waiting for messages,
+// advised to clients as timeout. Clients may ask for less.
+func WithTimeout(timeout time.Duration) Option {
+	return func(bs *bayeuxServer) {
+		bs.timeout = millisOf(timeout)
+	}
+}
+
+// WithInterval sets how long clients are advised to wait between a connect
+// reply and their next /meta/connect.
+func WithInterval(interval time.Duration) Option {
+	return func(bs *bayeuxServer) {
+		bs.interval = millisOf(interval)
+	}
+}
+
+// WithMaxInterval sets how long a client may go without a /meta/connect,
+// on top of the timeout, before its session is reaped. Non-positive values
+// are ignored.
+func WithMaxInterval(maxInterval time.Duration) Option {
+	return func(bs *bayeuxServer) {
+		if maxInterval > 0 {
+			bs.maxInterval = millisOf(maxInterval)
+		}
+	}
+}
+
+// WithTransports sets the connection types offered during handshake, in
+// order of preference.
+func WithTransports(transports ...string) Option {
+	return func(bs *bayeuxServer) {
+		bs.setTransports(transports...)
+	}
+}
+
+// WithWebSocketOptions configures the default websocket backend.
+func WithWebSocketOptions(opts WebSocketOptions) Option {
+	return func(bs *bayeuxServer) {
+		bs.setWebSocketUpgrader(NewWebSocketUpgrader(opts))
+	}
+}
+
+// WithQueueLimit bounds each client's outbound queue, zero or less being
+// unbounded, and sets what happens when it is full: OVERFLOW_DROP_OLDEST
+// drops the longest waiting message, OVERFLOW_DROP_NEWEST drops the message
+// being sent and OVERFLOW_DISCONNECT drops it and closes the client.
+func WithQueueLimit(limit int, policy int) Option {
+	return func(bs *bayeuxServer) {
+		bs.setQueueLimit(limit)
+		bs.setOverflowPolicy(policy)
+	}
+}
+
+// WithBatching sets how long a streaming transport waits after the first
+// queued message for more to send in the same frame, and caps the number of
+// messages and encoded bytes of a frame. Zero limits are unbounded.
+func WithBatching(window time.Duration, maxSize int, maxBytes int) Option {
+	return func(bs *bayeuxServer) {
+		bs.setBatchWindow(window)
+		bs.setMaxBatchSize(maxSize)
+		bs.setMaxBatchBytes(maxBytes)
+	}
+}
+
+// WithLogger replaces the package logger for the server and its clients.
+func WithLogger(logger *log.Logger) Option {
+	return func(bs *bayeuxServer) {
+		bs.logger = logger
+	}
+}
+
+// WithSecurityPolicy sets the policy consulted on handshake, channel
+// creation, subscribe and publish.
+func WithSecurityPolicy(policy SecurityPolicy) Option {
+	return func(bs *bayeuxServer) {
+		bs.setSecurityPolicy(policy)
+	}
+}
+
+// WithAuthenticator requires clients to pass authenticator during handshake.
+func WithAuthenticator(authenticator Authenticator) Option {
+	return func(bs *bayeuxServer) {
+		bs.setAuthenticator(authenticator)
+	}
+}
+
+// WithViolationLimit sets how many malformed messages a client may send
+// before it is disconnected.
+func WithViolationLimit(limit int) Option {
+	return func(bs *bayeuxServer) {
+		bs.setViolationLimit(limit)
+	}
+}
+
+// WithResumeGracePeriod keeps dropped websocket sessions around for grace so
+// that clients can reattach to them from a new connection.
+func WithResumeGracePeriod(grace time.Duration) Option {
+	return func(bs *bayeuxServer) {
+		bs.setResumeGracePeriod(grace)
+	}
+}
+
+// WithExtension registers ext for every client.
+func WithExtension(ext ServerExtension) Option {
+	return func(bs *bayeuxServer) {
+		bs.addExtension(ext)
+	}
+}
+
+// WithSessionListener registers l for client removals.
+func WithSessionListener(l SessionListener) Option {
+	return func(bs *bayeuxServer) {
+		bs.addSessionListener(l)
+	}
+}
+
+// WithOverflowListener registers l for messages dropped from full queues.
+func WithOverflowListener(l OverflowListener) Option {
+	return func(bs *bayeuxServer) {
+		bs.addOverflowListener(l)
+	}
+}
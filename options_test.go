@@ -0,0 +1,69 @@
+package bayeux
+
+import (
+	"bytes"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/ebittleman/go-bayeux/messages"
+)
+
+func TestHandlerOptionsAreIndependent(t *testing.T) {
+	buf := &bytes.Buffer{}
+	configured := Handler(
+		WithTimeout(5*time.Second),
+		WithInterval(time.Second),
+		WithMaxInterval(20*time.Second),
+		WithTransports(CLIENT_LONGPOLL),
+		WithQueueLimit(10, OVERFLOW_DISCONNECT),
+		WithLogger(log.New(buf, "", 0)),
+	)
+	defer configured.Close()
+
+	defaults := Handler()
+	defer defaults.Close()
+
+	cfg, defaultCfg := configOf(configured), configOf(defaults)
+	if cfg.timeout != 5000 || cfg.interval != 1000 || cfg.maxInterval != 20000 {
+		t.Errorf("Advice Not Configured: %d %d %d", cfg.timeout, cfg.interval, cfg.maxInterval)
+	}
+	if defaultCfg.timeout != defaultTimeout || defaultCfg.maxInterval != defaultMaxInterval {
+		t.Error("Options Leaked Into Another Server")
+	}
+	if cfg.queueLimit != 10 || cfg.overflowPolicy != OVERFLOW_DISCONNECT {
+		t.Error("Queue Not Configured")
+	}
+
+	reply := longPollHandshake(t, configured, CLIENT_LONGPOLL, CLIENT_WEBSOCKET)
+	if len(reply.SupportedConnectionTypes) != 1 || reply.Advice.MaxInterval != 20000 {
+		t.Errorf("Handshake Not Configured: %+v", reply)
+	}
+
+	replies, _ := longPollConnect(configured.(*bayeuxServer), reply.ClientId, 0)
+	if len(replies) != 1 {
+		t.Fatalf("Unexpected Replies %v", replies)
+	}
+	if advice := replies[0].(*messages.ConnectResponse).Advice; advice.Timeout != 5000 || advice.Interval != 1000 {
+		t.Errorf("Connect Advice Not Configured: %+v", advice)
+	}
+
+	if buf.Len() == 0 {
+		t.Error("Configured Logger Not Used")
+	}
+}
+
+func TestHandlerAuthorizationOptions(t *testing.T) {
+	secured := Handler(
+		WithSecurityPolicy(&testPolicy{}),
+		WithAuthenticator(NewHMACAuthenticator([]byte("secret"))),
+	)
+	defer secured.Close()
+
+	if _, ok := configOf(secured).securityPolicy.(*testPolicy); !ok {
+		t.Error("Security Policy Not Configured")
+	}
+	if _, ok := configOf(secured).authenticator.(*hmacAuthenticator); !ok {
+		t.Error("Authenticator Not Configured")
+	}
+}
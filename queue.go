@@ -0,0 +1,145 @@
+package bayeux
+
+import (
+	"sync"
+
+	"github.com/ebittleman/go-bayeux/messages"
+)
+
+const (
+	OVERFLOW_DROP_OLDEST = iota
+	OVERFLOW_DROP_NEWEST
+	OVERFLOW_DISCONNECT
+)
+
+// OverflowListener is notified when a message is dropped because a client's
+// outbound queue is full. policy is the overflow policy that was applied.
+type OverflowListener func(client Client, dropped messages.Message, policy int)
+
+// messageQueue holds the messages waiting to be written to a client, in
+// the order they were sent.
+type messageQueue struct {
+	msgs  []messages.Message
+	limit int
+	lock  *sync.Mutex
+	ready chan struct{}
+}
+
+// newMessageQueue creates a queue holding at most limit messages. A limit
+// of zero or less is unbounded.
+func newMessageQueue(limit int) *messageQueue {
+	return &messageQueue{make([]messages.Message, 0), limit, &sync.Mutex{}, make(chan struct{}, 1)}
+}
+
+// Push appends msg. When the queue is full policy decides which message is
+// dropped, it is returned with overflowed set.
+func (q *messageQueue) Push(msg messages.Message, policy int) (dropped messages.Message, overflowed bool) {
+	q.lock.Lock()
+	if q.limit > 0 && len(q.msgs) >= q.limit {
+		overflowed = true
+		switch policy {
+		case OVERFLOW_DROP_OLDEST:
+			dropped = q.msgs[0]
+			q.msgs = append(q.msgs[1:], msg)
+		default:
+			dropped = msg
+		}
+	} else {
+		q.msgs = append(q.msgs, msg)
+	}
+	q.lock.Unlock()
+
+	q.signal()
+
+	return dropped, overflowed
+}
+
+// PushFront puts back messages that could not be written so that they are
+// the next ones out. It may take the queue past its limit.
+func (q *messageQueue) PushFront(msgs ...messages.Message) {
+	q.lock.Lock()
+	q.msgs = append(append(make([]messages.Message, 0, len(msgs)+len(q.msgs)), msgs...), q.msgs...)
+	q.lock.Unlock()
+
+	q.signal()
+}
+
+func (q *messageQueue) signal() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+func (q *messageQueue) Pop() (messages.Message, bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if len(q.msgs) == 0 {
+		return nil, false
+	}
+
+	msg := q.msgs[0]
+	q.msgs[0] = nil
+	q.msgs = q.msgs[1:]
+
+	return msg, true
+}
+
+// Drain empties the queue, returning its messages in order.
+func (q *messageQueue) Drain() []messages.Message {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	msgs := q.msgs
+	q.msgs = make([]messages.Message, 0)
+
+	return msgs
+}
+
+func (q *messageQueue) Len() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return len(q.msgs)
+}
+
+// Ready is signalled after messages are pushed.
+func (q *messageQueue) Ready() <-chan struct{} {
+	return q.ready
+}
+
+// setQueueLimit bounds the number of messages waiting to be written to each
+// client. Zero or less is unbounded.
+func (bs *bayeuxServer) setQueueLimit(limit int) {
+	bs.queueLimit = limit
+}
+
+// setOverflowPolicy decides what happens when a client's queue is full:
+// OVERFLOW_DROP_OLDEST drops the longest waiting message, OVERFLOW_DROP_NEWEST
+// drops the message being sent and OVERFLOW_DISCONNECT drops it and closes
+// the client.
+func (bs *bayeuxServer) setOverflowPolicy(policy int) {
+	bs.overflowPolicy = policy
+}
+
+// addOverflowListener registers l for dropped messages.
+func (bs *bayeuxServer) addOverflowListener(l OverflowListener) {
+	bs.overflowListeners = append(bs.overflowListeners, l)
+}
+
+// onQueueOverflow is called when the client's queue dropped a message.
+func (c *baseClient) onQueueOverflow(dropped messages.Message) {
+	policy := c.config.overflowPolicy
+
+	c.GetLogger().Printf("Queue Overflow For Client '%s'\n", c.GetId())
+
+	for _, l := range c.config.overflowListeners {
+		l(c.self, dropped, policy)
+	}
+
+	// Closing may wait on a write stalled by the slow consumer, which must
+	// not hold up the broadcast that overflowed it.
+	if policy == OVERFLOW_DISCONNECT {
+		go c.self.Close()
+	}
+}
@@ -0,0 +1,86 @@
+package bayeux
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ebittleman/go-bayeux/messages"
+)
+
+func TestMessageQueueOverflowPolicies(t *testing.T) {
+	cases := []struct {
+		policy  int
+		dropped messages.Message
+		kept    []messages.Message
+	}{
+		{OVERFLOW_DROP_OLDEST, 1, []messages.Message{2, 3}},
+		{OVERFLOW_DROP_NEWEST, 3, []messages.Message{1, 2}},
+		{OVERFLOW_DISCONNECT, 3, []messages.Message{1, 2}},
+	}
+
+	for _, c := range cases {
+		q := newMessageQueue(2)
+		q.Push(1, c.policy)
+		q.Push(2, c.policy)
+
+		dropped, overflowed := q.Push(3, c.policy)
+		if !overflowed || dropped != c.dropped {
+			t.Errorf("Policy %d Dropped %v, expected %v", c.policy, dropped, c.dropped)
+		}
+		if kept := q.Drain(); !reflect.DeepEqual(kept, c.kept) {
+			t.Errorf("Policy %d Kept %v, expected %v", c.policy, kept, c.kept)
+		}
+	}
+}
+
+func TestQueueOverflowNotifiesListeners(t *testing.T) {
+	server := Handler()
+	defer server.Close()
+	bs := server.(*bayeuxServer)
+	bs.setQueueLimit(2)
+
+	dropped := make([]messages.Message, 0)
+	clients := make([]Client, 0)
+	bs.addOverflowListener(func(client Client, msg messages.Message, policy int) {
+		dropped = append(dropped, msg)
+		clients = append(clients, client)
+	})
+
+	clientId := longPollHandshake(t, server, CLIENT_LONGPOLL).ClientId
+	bs.HandleLongPoll([]map[string]interface{}{
+		{"channel": "/meta/subscribe", "clientId": clientId, "subscription": "/ticks"},
+	})
+
+	for i := 1; i <= 3; i++ {
+		server.Deliver(clientId, map[string]interface{}{"channel": "/ticks", "data": i})
+	}
+
+	queued := server.GetClient(clientId).(*longPollClient).Flush(false)
+	if len(queued) != 2 || queued[0].(map[string]interface{})["data"] != 2 {
+		t.Errorf("Oldest Message Not Dropped: %v", queued)
+	}
+	if len(dropped) != 1 || dropped[0].(map[string]interface{})["data"] != 1 {
+		t.Errorf("Listener Not Notified Of Dropped Message: %v", dropped)
+	}
+	if len(clients) != 1 || clients[0] != server.GetClient(clientId) {
+		t.Errorf("Listener Not Given The Transport Client: %v", clients)
+	}
+}
+
+func TestQueueOverflowDisconnects(t *testing.T) {
+	server := Handler(WithQueueLimit(1, OVERFLOW_DISCONNECT))
+	defer server.Close()
+
+	clientId := longPollHandshake(t, server, CLIENT_LONGPOLL).ClientId
+	server.Deliver(clientId, map[string]interface{}{"channel": "/ticks", "data": 1})
+	server.Deliver(clientId, map[string]interface{}{"channel": "/ticks", "data": 2})
+
+	// The client is closed off the sending goroutine.
+	for i := 0; i < 100 && server.GetClient(clientId) != nil; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	if server.GetClient(clientId) != nil {
+		t.Error("Overflowing Client Was Not Disconnected")
+	}
+}
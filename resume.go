@@ -0,0 +1,70 @@
+package bayeux
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/base64"
+	"time"
+)
+
+func newResumeKey() []byte {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+
+	return key
+}
+
+// setResumeGracePeriod keeps the session of a websocket client whose
+// connection drops for grace, so that the client can reattach to it from a
+// new connection. Subscriptions are kept and messages are queued meanwhile.
+// Sessions are still reaped once they miss the advised maxInterval. Zero,
+// the default, closes sessions with their connection.
+func (bs *bayeuxServer) setResumeGracePeriod(grace time.Duration) {
+	bs.resumeGrace = grace
+}
+
+// resumeToken is handed to websocket clients in the ext of a successful
+// handshake, as {"ext": {"resume": "..."}}. Sending it back in the ext of the
+// first message on a new connection, along with the old clientId, reattaches
+// the connection to the session. The example's ResumeExtension.js does so on
+// every /meta/connect.
+func (cfg *config) resumeToken(clientId string) string {
+	return base64.RawURLEncoding.EncodeToString(sign(cfg.resumeKey, clientId))
+}
+
+func (cfg *config) validResumeToken(clientId, token string) bool {
+	signature, err := base64.RawURLEncoding.DecodeString(token)
+	return err == nil && hmac.Equal(signature, sign(cfg.resumeKey, clientId))
+}
+
+// resume reattaches ws to the detached session named by the first message of
+// msgs. It returns the session along with the channel closed once ws is
+// released, or nil when msgs do not resume a valid session.
+func (bs *bayeuxServer) resume(ws WebSocketConn, msgs []map[string]interface{}) (*websocketClient, chan struct{}) {
+	if bs.resumeGrace <= 0 || len(msgs) == 0 {
+		return nil, nil
+	}
+
+	clientId, _ := msgs[0]["clientId"].(string)
+	ext, _ := msgs[0]["ext"].(map[string]interface{})
+	token, _ := ext["resume"].(string)
+	if clientId == "" || token == "" || !bs.validResumeToken(clientId, token) {
+		return nil, nil
+	}
+
+	client, _ := bs.GetClient(clientId).(*websocketClient)
+	if client == nil {
+		return nil, nil
+	}
+
+	lost := client.attach(ws, msgs, nil)
+	if lost == nil {
+		return nil, nil
+	}
+
+	bs.GetLogger().Printf("Session Resumed '%s'\n", clientId)
+
+	return client, lost
+}
@@ -0,0 +1,157 @@
+package bayeux
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func waitDetached(t *testing.T, client Client) {
+	t.Helper()
+	ws := client.(*websocketClient)
+	for i := 0; i < 100; i++ {
+		ws.lock.Lock()
+		detached := ws.ws == nil
+		ws.lock.Unlock()
+
+		if detached {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	t.Fatal("Client Was Not Detached")
+}
+
+// readUntil reads frames until one holds a message on channel, returning
+// that message and every message read before it by channel.
+func readUntil(t *testing.T, ws *websocket.Conn, channel string) (map[string]interface{}, map[string]map[string]interface{}) {
+	t.Helper()
+	ws.SetReadDeadline(time.Now().Add(time.Second))
+
+	seen := make(map[string]map[string]interface{})
+	for {
+		replies := make([]map[string]interface{}, 0)
+		if err := ws.ReadJSON(&replies); err != nil {
+			t.Fatal(err)
+		}
+		for _, reply := range replies {
+			name, _ := reply["channel"].(string)
+			if name == channel {
+				return reply, seen
+			}
+			seen[name] = reply
+		}
+	}
+}
+
+func TestWebSocketSessionResume(t *testing.T) {
+	server := Handler(WithResumeGracePeriod(time.Second))
+	defer server.Close()
+
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	url := "ws" + strings.TrimPrefix(ts.URL, "http")
+
+	first, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first.WriteJSON([]map[string]interface{}{
+		{"channel": "/meta/handshake", "version": "1.0", "supportedConnectionTypes": []string{CLIENT_WEBSOCKET}},
+	})
+	handshake, _ := readUntil(t, first, "/meta/handshake")
+	clientId, _ := handshake["clientId"].(string)
+	ext, _ := handshake["ext"].(map[string]interface{})
+	token, _ := ext["resume"].(string)
+	if token == "" {
+		t.Fatalf("Resume Token Missing: %v", handshake)
+	}
+
+	first.WriteJSON([]map[string]interface{}{
+		{"channel": "/meta/connect", "clientId": clientId, "connectionType": CLIENT_WEBSOCKET},
+		{"channel": "/meta/subscribe", "clientId": clientId, "subscription": "/chat"},
+	})
+	readUntil(t, first, "/meta/subscribe")
+	first.Close()
+
+	waitDetached(t, server.GetClient(clientId))
+	server.Publish("/chat", map[string]interface{}{"channel": "/chat", "data": "missed"})
+
+	// A forged token does not take over the session.
+	forged, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer forged.Close()
+
+	forged.WriteJSON([]map[string]interface{}{
+		{"channel": "/meta/connect", "clientId": clientId, "connectionType": CLIENT_WEBSOCKET, "ext": map[string]interface{}{"resume": "forged"}},
+	})
+	if reply, _ := readUntil(t, forged, "/meta/connect"); reply["successful"] != false {
+		t.Errorf("Forged Token Accepted: %v", reply)
+	}
+
+	second, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+
+	second.WriteJSON([]map[string]interface{}{
+		{"channel": "/meta/connect", "clientId": clientId, "connectionType": CLIENT_WEBSOCKET, "advice": map[string]int{"timeout": 0}, "ext": map[string]interface{}{"resume": token}},
+	})
+	reply, seen := readUntil(t, second, "/meta/connect")
+	if reply["successful"] != true {
+		t.Errorf("Resumed Connect Failed: %v", reply)
+	}
+	if msg := seen["/chat"]; msg["data"] != "missed" {
+		t.Errorf("Queued Message Not Delivered: %v", seen)
+	}
+}
+
+func TestWebSocketSessionExpires(t *testing.T) {
+	server := Handler(WithResumeGracePeriod(20 * time.Millisecond))
+	defer server.Close()
+
+	ws, done := dialWebSocket(t, server)
+	defer done()
+
+	ws.WriteJSON([]map[string]interface{}{
+		{"channel": "/meta/handshake", "version": "1.0", "supportedConnectionTypes": []string{CLIENT_WEBSOCKET}},
+	})
+	handshake, _ := readUntil(t, ws, "/meta/handshake")
+	clientId, _ := handshake["clientId"].(string)
+	ws.Close()
+
+	waitDetached(t, server.GetClient(clientId))
+	time.Sleep(100 * time.Millisecond)
+
+	if server.GetClient(clientId) != nil {
+		t.Error("Detached Session Was Not Closed After The Grace Period")
+	}
+}
+
+func TestResumeOnlyOfferedToWebSockets(t *testing.T) {
+	server := Handler(WithResumeGracePeriod(time.Second))
+	defer server.Close()
+
+	if reply := longPollHandshake(t, server, CLIENT_LONGPOLL); reply.Ext != nil {
+		t.Errorf("Resume Offered To Polling Client: %v", reply.Ext)
+	}
+
+	ws, done := dialWebSocket(t, server)
+	defer done()
+
+	ws.WriteJSON([]map[string]interface{}{
+		{"channel": "/meta/handshake", "version": "1.0", "supportedConnectionTypes": []string{CLIENT_WEBSOCKET}},
+	})
+	reply, _ := readUntil(t, ws, "/meta/handshake")
+	if ext, _ := reply["ext"].(map[string]interface{}); ext["resume"] == nil {
+		t.Errorf("Resume Not Offered To WebSocket Client: %v", reply)
+	}
+}
@@ -0,0 +1,35 @@
+package bayeux
+
+import (
+	"github.com/ebittleman/go-bayeux/messages"
+)
+
+// SecurityPolicy authorizes clients at each step of the protocol. msg is the
+// decoded request and ext its "ext" field, which may be nil.
+type SecurityPolicy interface {
+	CanHandshake(client Client, msg messages.Message, ext map[string]interface{}) bool
+	CanCreate(client Client, channel string, msg messages.Message, ext map[string]interface{}) bool
+	CanSubscribe(client Client, channel string, msg messages.Message, ext map[string]interface{}) bool
+	CanPublish(client Client, channel string, msg messages.Message, ext map[string]interface{}) bool
+}
+
+type allowAllPolicy struct{}
+
+// DefaultSecurityPolicy allows everything.
+var DefaultSecurityPolicy SecurityPolicy = &allowAllPolicy{}
+
+func (p *allowAllPolicy) CanHandshake(Client, messages.Message, map[string]interface{}) bool {
+	return true
+}
+
+func (p *allowAllPolicy) CanCreate(Client, string, messages.Message, map[string]interface{}) bool {
+	return true
+}
+
+func (p *allowAllPolicy) CanSubscribe(Client, string, messages.Message, map[string]interface{}) bool {
+	return true
+}
+
+func (p *allowAllPolicy) CanPublish(Client, string, messages.Message, map[string]interface{}) bool {
+	return true
+}
@@ -0,0 +1,64 @@
+package bayeux
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ebittleman/go-bayeux/messages"
+)
+
+type testPolicy struct {
+	allowAllPolicy
+}
+
+func (p *testPolicy) CanHandshake(client Client, msg messages.Message, ext map[string]interface{}) bool {
+	return ext["token"] == "secret"
+}
+
+func (p *testPolicy) CanCreate(client Client, channel string, msg messages.Message, ext map[string]interface{}) bool {
+	return !strings.HasPrefix(channel, "/private/")
+}
+
+func (p *testPolicy) CanPublish(client Client, channel string, msg messages.Message, ext map[string]interface{}) bool {
+	return channel != "/readonly"
+}
+
+func TestSecurityPolicyDenials(t *testing.T) {
+	server := Handler(WithSecurityPolicy(&testPolicy{}))
+	defer server.Close()
+	bs := server.(*bayeuxServer)
+
+	reply := longPollHandshake(t, server, CLIENT_LONGPOLL)
+	if reply.Successful || !strings.HasPrefix(reply.Error, "403:") {
+		t.Fatalf("Handshake Should Have Been Denied %v", reply)
+	}
+
+	replies, _ := bs.HandleLongPoll([]map[string]interface{}{
+		{"channel": "/meta/handshake", "version": "1.0", "supportedConnectionTypes": []string{CLIENT_LONGPOLL}, "ext": map[string]interface{}{"token": "secret"}},
+	})
+	clientId := replies[0].(*messages.HandshakeResponse).ClientId
+	if !replies[0].(*messages.HandshakeResponse).Successful {
+		t.Fatalf("Handshake Should Have Been Allowed %v", replies[0])
+	}
+
+	replies, _ = bs.HandleLongPoll([]map[string]interface{}{
+		{"channel": "/meta/subscribe", "clientId": clientId, "subscription": "/private/room"},
+		{"channel": "/readonly", "clientId": clientId, "data": "hi", "id": "2"},
+	})
+	if len(replies) != 2 {
+		t.Fatalf("Unexpected Replies %v", replies)
+	}
+
+	subscribe := replies[0].(*messages.SubscribeResponse)
+	if subscribe.Successful || subscribe.Error != "403:/private/room:Create Denied" {
+		t.Errorf("Unexpected Subscribe Reply %v", subscribe)
+	}
+	if server.GetChannels().Get("/private/room") != nil {
+		t.Error("Denied Channel Was Created")
+	}
+
+	publish := replies[1].(*messages.PublishResponse)
+	if publish.Successful || publish.Error != "403:/readonly:Publish Denied" {
+		t.Errorf("Unexpected Publish Reply %v", publish)
+	}
+}
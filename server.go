@@ -2,36 +2,41 @@ package bayeux
 
 import (
 	"bytes"
-	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
-	"fmt"
 	"io"
 	"log"
-	"math/rand"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
-	"code.google.com/p/go.net/websocket"
-
 	"github.com/ebittleman/go-bayeux/channel"
 	"github.com/ebittleman/go-bayeux/messages"
 )
 
 type BayeuxHandler func(msg messages.RawMessage)
 
+// inbox holds the messages received from one session that are waiting to be
+// routed, running is set while a goroutine is draining it.
+type inbox struct {
+	msgs    []messages.RawMessage
+	running bool
+}
+
 type bayeuxServer struct {
 	channelHandlers       map[string]BayeuxHandler
-	channels              map[string]channel.Channel
+	channels              channel.Tree
 	clients               map[string]Client
 	clientMutex           *sync.Mutex
 	channelHandlerslMutex *sync.Mutex
-	channelsMutex         *sync.Mutex
-	websocketHandler      http.Handler
 	incomingCh            chan messages.RawMessage
+	inboxes               map[string]*inbox
+	inboxLock             *sync.Mutex
 	done                  chan struct{}
-
-	logger *log.Logger
+	closeOnce             *sync.Once
+	*config
 }
 
 type Server interface {
@@ -42,73 +47,150 @@ type Server interface {
 	RegisterClient(string, Client)
 	UnregisterClient(string) error
 	GetClient(string) Client
+	GetChannels() channel.Tree
 	OnReceiveMessage(string, string, []byte)
 	Close() error
 
 	Publish(string, messages.Message)
+	Deliver(string, messages.Message) bool
 
 	GetLogger() *log.Logger
 }
 
 func (s *bayeuxServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	s.websocketHandler.ServeHTTP(w, r)
+	if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		if !s.TransportEnabled(CLIENT_WEBSOCKET) {
+			http.Error(w, "Transport Not Enabled", http.StatusBadRequest)
+			return
+		}
+		s.ServeWebSocket(w, r)
+		return
+	}
+
+	if strings.Contains(r.Header.Get("Accept"), "text/event-stream") || r.URL.Query().Get("stream") != "" {
+		if !s.TransportEnabled(CLIENT_SSE) {
+			http.Error(w, "Transport Not Enabled", http.StatusBadRequest)
+			return
+		}
+		if r.Method == "GET" {
+			s.ServeEventSource(w, r)
+		} else {
+			s.ServeEventSourcePost(w, r)
+		}
+		return
+	}
+
+	if r.Method == "GET" && r.URL.Query().Get("message") != "" {
+		if !s.TransportEnabled(CLIENT_CALLBACK) {
+			http.Error(w, "Transport Not Enabled", http.StatusBadRequest)
+			return
+		}
+		s.ServeCallbackPoll(w, r)
+		return
+	}
+
+	if !s.TransportEnabled(CLIENT_LONGPOLL) {
+		http.Error(w, "Transport Not Enabled", http.StatusBadRequest)
+		return
+	}
+	s.ServeLongPoll(w, r)
 }
 
-func Handler() Server {
+// Handler creates a server configured by opts, starting with the package
+// defaults.
+func Handler(opts ...Option) Server {
 
 	server := &bayeuxServer{
 		make(map[string]BayeuxHandler),
-		make(map[string]channel.Channel),
+		channel.NewTree(),
 		make(map[string]Client),
 		&sync.Mutex{},
 		&sync.Mutex{},
-		&sync.Mutex{},
-		nil,
 		make(chan messages.RawMessage),
+		make(map[string]*inbox),
+		&sync.Mutex{},
 		make(chan struct{}),
-		logger,
+		&sync.Once{},
+		newConfig(),
+	}
+
+	for _, opt := range opts {
+		opt(server)
 	}
 
 	server.HandleFunc("/meta/handshake", func(msg messages.RawMessage) {
 		handshakeRequest := &messages.HandshakeRequest{}
-		json.Unmarshal(msg.Payload, handshakeRequest)
+		if err := json.Unmarshal(msg.Payload, handshakeRequest); err != nil {
+			ReportProtocolError(server, msg, err)
+			return
+		}
 		Handshake(server, msg.ClientId, handshakeRequest)
 	})
 
 	server.HandleFunc("/meta/disconnect", func(msg messages.RawMessage) {
 		disconnectRequest := &messages.DisconnectRequest{}
-		json.Unmarshal(msg.Payload, disconnectRequest)
-		Disconnect(server, disconnectRequest)
+		if err := json.Unmarshal(msg.Payload, disconnectRequest); err != nil {
+			ReportProtocolError(server, msg, err)
+			return
+		}
+		Disconnect(server, msg.ClientId, disconnectRequest)
 	})
 
 	server.HandleFunc("/meta/connect", func(msg messages.RawMessage) {
 		connectRequest := &messages.ConnectRequest{}
-		json.Unmarshal(msg.Payload, connectRequest)
-		Connect(server, connectRequest)
+		if err := json.Unmarshal(msg.Payload, connectRequest); err != nil {
+			ReportProtocolError(server, msg, err)
+			return
+		}
+		Connect(server, msg.ClientId, connectRequest)
 	})
 
 	server.HandleFunc("/meta/subscribe", func(msg messages.RawMessage) {
 		subscribeRequest := &messages.SubscribeRequest{}
-		json.Unmarshal(msg.Payload, subscribeRequest)
-		server.HandleSubscribe(subscribeRequest)
+		if err := json.Unmarshal(msg.Payload, subscribeRequest); err != nil {
+			ReportProtocolError(server, msg, err)
+			return
+		}
+		server.HandleSubscribe(msg.ClientId, subscribeRequest)
 	})
 
 	server.HandleFunc("/meta/unsubscribe", func(msg messages.RawMessage) {
 		subscribeResponse := &messages.SubscribeResponse{}
-		json.Unmarshal(msg.Payload, subscribeResponse)
-		server.HandleUnsubscribe(subscribeResponse)
-	})
-
-	server.websocketHandler = websocket.Handler(func(ws *websocket.Conn) {
-		client := NewClient(GenerateNewClientId(), ws, server)
-		server.RegisterClient(client.GetId(), client)
-		client.Wait()
+		if err := json.Unmarshal(msg.Payload, subscribeResponse); err != nil {
+			ReportProtocolError(server, msg, err)
+			return
+		}
+		server.HandleUnsubscribe(msg.ClientId, subscribeResponse)
 	})
 
 	go server.Loop()
+	go server.SweepLoop()
 	return server
 }
 
+// EncodeBatch serializes msgs as a JSON array, copying the bytes of
+// messages that are already encoded rather than re-encoding them.
+func EncodeBatch(msgs []interface{}) ([]byte, error) {
+	buf := bytes.Buffer{}
+	buf.WriteByte('[')
+
+	for i, msg := range msgs {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+
+		encoded, err := messages.Encode(msg)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(encoded)
+	}
+
+	buf.WriteByte(']')
+
+	return buf.Bytes(), nil
+}
+
 func ParseReqBody(body io.Reader, v interface{}) error {
 	buf := bytes.Buffer{}
 	buf.ReadFrom(body)
@@ -121,23 +203,50 @@ func (bs *bayeuxServer) HandleFunc(channel string, handleFunc BayeuxHandler) {
 	bs.channelHandlerslMutex.Unlock()
 }
 
-func (bs *bayeuxServer) GetHandler(channel string) BayeuxHandler {
+func (bs *bayeuxServer) GetHandler(channelName string) BayeuxHandler {
 	var (
 		handleFunc BayeuxHandler
 		ok         bool
 	)
 
 	bs.channelHandlerslMutex.Lock()
-	handleFunc, ok = bs.channelHandlers[channel]
+	handleFunc, ok = bs.channelHandlers[channelName]
 	bs.channelHandlerslMutex.Unlock()
 
-	if !ok {
-		bs.channelsMutex.Lock()
-		_, ok := bs.channels[channel]
-		if ok {
-			handleFunc = GeneratePublicMesaageHandler(bs)
+	if ok {
+		return handleFunc
+	}
+
+	switch {
+	case channel.IsService(channelName):
+		handleFunc = bs.matchHandler(channelName)
+		if handleFunc == nil {
+			handleFunc = GenerateServiceMessageHandler(bs)
+		}
+	case !channel.IsMeta(channelName) && !channel.IsWildcard(channelName):
+		handleFunc = GeneratePublicMesaageHandler(bs)
+	}
+
+	return handleFunc
+}
+
+// matchHandler finds a handler registered on a wildcard channel matching
+// channelName, e.g. "/service/**".
+func (bs *bayeuxServer) matchHandler(channelName string) BayeuxHandler {
+	bs.channelHandlerslMutex.Lock()
+	defer bs.channelHandlerslMutex.Unlock()
+
+	var (
+		handleFunc BayeuxHandler
+		best       int
+	)
+
+	// Prefer the most specific pattern.
+	for pattern, h := range bs.channelHandlers {
+		if channel.IsWildcard(pattern) && channel.Match(pattern, channelName) && len(pattern) > best {
+			handleFunc = h
+			best = len(pattern)
 		}
-		bs.channelsMutex.Unlock()
 	}
 
 	return handleFunc
@@ -149,10 +258,7 @@ func (bs *bayeuxServer) RegisterClient(id string, client Client) {
 	bs.clientMutex.Unlock()
 }
 func (bs *bayeuxServer) UnregisterClient(id string) error {
-	bs.clientMutex.Lock()
-	delete(bs.clients, id)
-	bs.clientMutex.Unlock()
-
+	bs.removeClient(id, false)
 	return nil
 }
 
@@ -166,6 +272,72 @@ func (bs *bayeuxServer) GetClient(id string) Client {
 	return client
 }
 
+// setTransports sets the connection types offered during handshake, in order
+// of preference.
+func (bs *bayeuxServer) setTransports(transports ...string) {
+	bs.transports = transports
+}
+
+// setWebSocketUpgrader replaces the WebSocket backend.
+func (bs *bayeuxServer) setWebSocketUpgrader(upgrader WebSocketUpgrader) {
+	bs.websocketUpgrader = upgrader
+}
+
+func (bs *bayeuxServer) ServeWebSocket(w http.ResponseWriter, r *http.Request) {
+	ws, err := bs.websocketUpgrader.Upgrade(w, r)
+	if err != nil {
+		bs.GetLogger().Printf("WebSocket Upgrade Failed: %s\n", err)
+		return
+	}
+
+	// The first frame of a reconnecting client may resume its session.
+	msgs := make([]map[string]interface{}, 0)
+	err = ws.ReadJSON(&msgs)
+	if err == nil {
+		if client, lost := bs.resume(ws, msgs); client != nil {
+			<-lost
+			return
+		}
+	}
+
+	client := newWebSocketClient(GenerateNewClientId(), bs)
+	bs.RegisterClient(client.GetId(), client)
+	lost := client.attach(ws, msgs, err)
+
+	<-lost
+}
+
+// setSecurityPolicy replaces the policy consulted on handshake, channel
+// creation, subscribe and publish.
+func (bs *bayeuxServer) setSecurityPolicy(policy SecurityPolicy) {
+	bs.securityPolicy = policy
+}
+
+// setAuthenticator requires clients to pass authenticator during handshake.
+func (bs *bayeuxServer) setAuthenticator(authenticator Authenticator) {
+	bs.authenticator = authenticator
+}
+
+// setViolationLimit sets how many malformed messages a client may send
+// before its session is dropped. Zero never drops sessions.
+func (bs *bayeuxServer) setViolationLimit(limit int) {
+	bs.violationLimit = limit
+}
+
+func (bs *bayeuxServer) GetChannels() channel.Tree {
+	return bs.channels
+}
+
+func (bs *bayeuxServer) TransportEnabled(transport string) bool {
+	for _, t := range bs.transports {
+		if t == transport {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (bs *bayeuxServer) OnReceiveMessage(channel string, clientId string, payload []byte) {
 	bs.incomingCh <- messages.RawMessage{channel, clientId, payload}
 }
@@ -174,30 +346,91 @@ func (bs *bayeuxServer) Loop() {
 	for {
 		select {
 		case msg := <-bs.incomingCh:
-			go RouteIncomingMsg(bs, msg)
+			bs.dispatch(msg)
 		case <-bs.done:
 			return
 		}
 	}
 }
 
-func (bs *bayeuxServer) Publish(channelPath string, msg messages.Message) {
-	bs.channelsMutex.Lock()
-	ch, ok := bs.channels[channelPath]
+// dispatch queues msg behind the messages already received from the same
+// session. Each session's messages are routed in order by their own
+// goroutine, so sessions are still processed in parallel.
+func (bs *bayeuxServer) dispatch(msg messages.RawMessage) {
+	bs.inboxLock.Lock()
+	defer bs.inboxLock.Unlock()
+
+	box, ok := bs.inboxes[msg.ClientId]
 	if !ok {
-		fmt.Printf("Channel Not Found '%s'\n", channelPath)
+		box = &inbox{make([]messages.RawMessage, 0), false}
+		bs.inboxes[msg.ClientId] = box
+	}
+
+	box.msgs = append(box.msgs, msg)
+	if !box.running {
+		box.running = true
+		go bs.drain(msg.ClientId, box)
+	}
+}
+
+// drain routes the messages of box until it is empty. A /meta/connect may
+// be held for the advised timeout, so it is routed on its own goroutine once
+// the messages before it are done, letting the ones after it through.
+func (bs *bayeuxServer) drain(clientId string, box *inbox) {
+	for {
+		bs.inboxLock.Lock()
+		if len(box.msgs) == 0 {
+			box.running = false
+			delete(bs.inboxes, clientId)
+			bs.inboxLock.Unlock()
+			return
+		}
+		msg := box.msgs[0]
+		box.msgs = box.msgs[1:]
+		bs.inboxLock.Unlock()
+
+		if msg.Channel == "/meta/connect" {
+			go RouteIncomingMsg(bs, msg)
+			continue
+		}
+
+		RouteIncomingMsg(bs, msg)
+	}
+}
+
+// Publish delivers msg to subscribers of channelPath and of every wildcard
+// channel matching it.
+func (bs *bayeuxServer) Publish(channelPath string, msg messages.Message) {
+	if channel.IsService(channelPath) {
+		bs.GetLogger().Printf("Refusing To Broadcast On Service Channel '%s'\n", channelPath)
 		return
 	}
-	bs.channelsMutex.Unlock()
-	ch.Publish(msg)
+
+	matched := bs.channels.Match(channelPath)
+	if len(matched) == 0 {
+		bs.GetLogger().Printf("Channel Not Found '%s'\n", channelPath)
+		return
+	}
+
+	channel.Broadcast(matched, msg)
 }
 
-func (bs *bayeuxServer) Close() error {
-	if bs.done == nil {
-		return nil
+// Deliver sends msg to a single client without going through channel
+// subscriptions, e.g. to reply privately to a /service/** message.
+func (bs *bayeuxServer) Deliver(clientId string, msg messages.Message) bool {
+	client := bs.GetClient(clientId)
+	if client == nil {
+		return false
 	}
-	close(bs.done)
-	bs.done = nil
+
+	client.SendMessage(msg)
+	return true
+}
+
+func (bs *bayeuxServer) Close() error {
+	bs.closeOnce.Do(func() {
+		close(bs.done)
+	})
 	return nil
 }
 
@@ -206,79 +439,209 @@ func (bs *bayeuxServer) GetLogger() *log.Logger {
 }
 
 func RouteIncomingMsg(bs Server, msg messages.RawMessage) {
+	// A failing handler must not take the server down with it, the sender
+	// gets a 500 reply instead.
+	defer func() {
+		if r := recover(); r != nil {
+			bs.GetLogger().Printf("Handler for Channel '%s' Failed: %v\n", msg.Channel, r)
+			SendError(bs, msg.ClientId, msg.Channel, MessageId(msg.Payload), NewError(500, "Internal Server Error"), nil)
+		}
+	}()
+
+	if !strings.HasPrefix(msg.Channel, "/") {
+		ReportProtocolError(bs, msg, NewError(400, "Invalid Channel", msg.Channel))
+		return
+	}
+
+	if sender := bs.GetClient(msg.ClientId); sender != nil {
+		ok, err := ExtendIncoming(bs, sender, &msg)
+		if err != nil {
+			ReportProtocolError(bs, msg, err)
+			return
+		}
+		if !ok {
+			bs.GetLogger().Printf("Message On '%s' Dropped By Extension\n", msg.Channel)
+			return
+		}
+	}
+
 	handler := bs.GetHandler(msg.Channel)
 
 	if handler == nil {
-		fmt.Printf("Not Handler for Channel '%s'\n", msg.Channel)
+		bs.GetLogger().Printf("No Handler For Channel '%s'\n", msg.Channel)
+		ReportProtocolError(bs, msg, NewError(400, "Unknown Channel", msg.Channel))
 		return
 	}
 
 	handler(msg)
 }
 
-func GenerateNewClientId() string {
-	rand.Seed(time.Now().UnixNano())
-	id := fmt.Sprintf("%d", rand.Int63())
-	h := md5.New()
+// GetSession looks up the session clientId for a message received from
+// senderId. It is nil unless the session exists, belongs to the sender and
+// has completed a handshake.
+func GetSession(bs Server, senderId string, clientId string) Client {
+	client := bs.GetClient(clientId)
+	if client == nil || clientId != senderId || client.GetState() == STATE_UNCONNECTED {
+		return nil
+	}
 
-	h.Write([]byte(id))
+	return client
+}
 
-	return fmt.Sprintf("%x", h.Sum(nil))
+// GenerateNewClientId returns a random session id. Polling transports take
+// the id alone as proof of the session, so it must not be guessable.
+func GenerateNewClientId() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		panic(err)
+	}
+
+	return hex.EncodeToString(id)
 }
 
 func Handshake(bs Server, ClientId string, msg *messages.HandshakeRequest) {
 	client := bs.GetClient(ClientId)
 	if client == nil {
-		panic("can't handshake someone who does not exist?")
+		bs.GetLogger().Printf("Handshake From Unknown Client '%s'\n", ClientId)
+		return
 	}
 
 	bs.GetLogger().Printf("Do Handshake\n%v\n", msg)
 	bs.GetLogger().Printf("For Client\n%v\n", client)
 
+	cfg := configOf(bs)
+	transports := NegotiateTransports(cfg.transports, msg.SupportedConnectionTypes)
+
+	errMsg := ""
+	switch {
+	case msg.Version != "" && CompareVersions(msg.Version, BAYEUX_MINIMUM_VERSION) < 0:
+		errMsg = NewError(400, "Version Not Supported", msg.Version).Error()
+	case msg.MinimumVersion != "" && CompareVersions(msg.MinimumVersion, BAYEUX_VERSION) > 0:
+		errMsg = NewError(400, "Minimum Version Not Supported", msg.MinimumVersion).Error()
+	case len(transports) == 0:
+		errMsg = NewError(400, "Unsupported Connection Types", msg.SupportedConnectionTypes...).Error()
+	}
+
+	authenticated := false
+	if errMsg == "" && cfg.authenticator != nil {
+		identity, err := cfg.authenticator.Authenticate(client, msg.Ext)
+		if err != nil {
+			errMsg = NewError(403, "Authentication Failed, "+err.Error()).Error()
+		} else {
+			client.SetIdentity(identity)
+			authenticated = identity != nil
+		}
+	}
+
+	if errMsg == "" && !cfg.securityPolicy.CanHandshake(client, msg, msg.Ext) {
+		errMsg = NewError(403, "Handshake Denied").Error()
+	}
+
+	if errMsg != "" {
+		client.SendMessage(&messages.HandshakeResponse{
+			msg.Channel,
+			BAYEUX_VERSION,
+			BAYEUX_MINIMUM_VERSION,
+			cfg.transports,
+			"",
+			false,
+			false,
+			errMsg,
+			msg.Id,
+			&messages.HandshakeResponseAdvice{RECONNECT_NONE, 0, 0},
+			nil,
+		})
+
+		// There is no session to keep once the reply is out.
+		closeAfterFlush(client, CLOSE_NORMAL)
+		return
+	}
+
+	client.SetState(STATE_CONNECTING)
+
+	// Only websocket sessions outlive their connection.
+	var ext map[string]interface{}
+	if _, ok := client.(*websocketClient); ok && cfg.resumeGrace > 0 {
+		ext = map[string]interface{}{"resume": cfg.resumeToken(ClientId)}
+	}
+
 	client.SendMessage(&messages.HandshakeResponse{
 		msg.Channel,
-		"1.0",
-		"1.0",
-		supportedClients,
+		BAYEUX_VERSION,
+		BAYEUX_MINIMUM_VERSION,
+		transports,
 		ClientId,
 		true,
-		true,
+		authenticated,
 		"",
 		msg.Id,
-		&messages.HandshakeResponseAdvice{RECONNECT_RETRY, 0},
+		&messages.HandshakeResponseAdvice{RECONNECT_RETRY, 0, cfg.maxInterval},
+		ext,
 	})
 
 }
 
-func Disconnect(bs Server, msg *messages.DisconnectRequest) {
-	client := bs.GetClient(msg.ClientId)
+func Disconnect(bs Server, senderId string, msg *messages.DisconnectRequest) {
+	client := GetSession(bs, senderId, msg.ClientId)
 	if client == nil {
+		SendUnknownClient(bs, senderId, msg.Channel, msg.ClientId, msg.Id)
 		return
 	}
 
 	bs.GetLogger().Printf("Do Dissconnect\n%v\n", msg)
 	bs.GetLogger().Printf("For Client\n%v\n", client)
 
-	client.Close()
-
 	client.SendMessage(&messages.DisconnectResponse{
 		msg.Channel,
 		msg.ClientId,
 		true,
 		msg.Id,
 	})
+
+	closeAfterFlush(client, CLOSE_NORMAL)
 }
 
-func Connect(bs Server, msg *messages.ConnectRequest) {
-	client := bs.GetClient(msg.ClientId)
+// Connect answers a /meta/connect received from senderId, holding the reply
+// for the advised timeout once the client is connected.
+func Connect(bs Server, senderId string, msg *messages.ConnectRequest) {
+	client := GetSession(bs, senderId, msg.ClientId)
 	if client == nil {
-		panic("can't connect someone who does not exist?")
+		sender := bs.GetClient(senderId)
+		if sender == nil {
+			return
+		}
+
+		sender.SendMessage(&messages.ConnectResponse{
+			msg.Channel,
+			false,
+			NewError(402, "Unknown client", msg.ClientId).Error(),
+			msg.ClientId,
+			NewTimestamp().String(),
+			msg.Id,
+			&messages.ConnectAdvice{RECONNECT_HANDSHAKE, 0, 0, 0},
+		})
+		return
 	}
 
 	bs.GetLogger().Printf("Do Connect\n%v\n", msg)
 	bs.GetLogger().Printf("For Client\n%v\n", client)
 
-	//TODO Implement Connect
+	client.Touch()
+
+	// The client may ask for a shorter hold, but never a longer one than
+	// the session reaper allows for.
+	cfg := configOf(bs)
+	timeout := cfg.timeout
+	if msg.Advice != nil && msg.Advice.Timeout != nil && *msg.Advice.Timeout < timeout {
+		timeout = *msg.Advice.Timeout
+	}
+
+	// The first connect after handshake returns straight away.
+	if client.GetState() == STATE_CONNECTED && timeout > 0 {
+		client.Hold(time.Duration(timeout) * time.Millisecond)
+	}
+	client.SetState(STATE_CONNECTED)
+	client.Touch()
 
 	client.SendMessage(&messages.ConnectResponse{
 		msg.Channel,
@@ -287,27 +650,81 @@ func Connect(bs Server, msg *messages.ConnectRequest) {
 		msg.ClientId,
 		NewTimestamp().String(),
 		msg.Id,
-		&messages.ConnectAdvice{RECONNECT_HANDSHAKE, 120000},
+		&messages.ConnectAdvice{RECONNECT_RETRY, cfg.interval, cfg.timeout, cfg.maxInterval},
 	})
 }
 
-func (bs *bayeuxServer) HandleSubscribe(msg *messages.SubscribeRequest) {
-	client := bs.GetClient(msg.ClientId)
+func (bs *bayeuxServer) HandleSubscribe(senderId string, msg *messages.SubscribeRequest) {
+	client := GetSession(bs, senderId, msg.ClientId)
 	if client == nil {
-		panic("can't handshake someone who does not exist?")
+		SendUnknownClient(bs, senderId, msg.Channel, msg.ClientId, msg.Id)
+		return
 	}
 	bs.GetLogger().Printf("Do Subscribe\n%v\n", msg)
 	bs.GetLogger().Printf("For Client\n%v\n", client)
 
-	bs.channelsMutex.Lock()
-	ch, ok := bs.channels[msg.Subscription]
-	if !ok {
-		ch = channel.NewChannel(msg.Subscription)
-		bs.channels[msg.Subscription] = ch
+	if !channel.IsValid(msg.Subscription) {
+		client.SendMessage(&messages.SubscribeResponse{
+			msg.Channel,
+			msg.ClientId,
+			msg.Subscription,
+			false,
+			NewError(400, "Invalid Subscription", msg.Subscription).Error(),
+			NewTimestamp().String(),
+			msg.Id,
+		})
+		return
+	}
+
+	// Service channels are never broadcast so there is nothing to subscribe
+	// to, the request is acknowledged and otherwise ignored.
+	if channel.IsService(msg.Subscription) {
+		client.SendMessage(&messages.SubscribeResponse{
+			msg.Channel,
+			msg.ClientId,
+			msg.Subscription,
+			true,
+			"",
+			NewTimestamp().String(),
+			msg.Id,
+		})
+		return
 	}
-	bs.channelsMutex.Unlock()
 
-	client.Subscribe(ch)
+	policy := bs.securityPolicy
+
+	errMsg := ""
+	switch {
+	case bs.channels.Get(msg.Subscription) == nil && !policy.CanCreate(client, msg.Subscription, msg, msg.Ext):
+		errMsg = NewError(403, "Create Denied", msg.Subscription).Error()
+	case !policy.CanSubscribe(client, msg.Subscription, msg, msg.Ext):
+		errMsg = NewError(403, "Subscribe Denied", msg.Subscription).Error()
+	}
+
+	if errMsg != "" {
+		client.SendMessage(&messages.SubscribeResponse{
+			msg.Channel,
+			msg.ClientId,
+			msg.Subscription,
+			false,
+			errMsg,
+			NewTimestamp().String(),
+			msg.Id,
+		})
+		return
+	}
+
+	var ch channel.Channel
+	for {
+		ch = bs.channels.GetOrCreate(msg.Subscription)
+		client.Subscribe(ch)
+
+		// The channel may have been pruned before the subscription landed.
+		if bs.channels.Get(msg.Subscription) == ch {
+			break
+		}
+		client.Unsubscribe(ch)
+	}
 
 	client.SendMessage(&messages.SubscribeResponse{
 		msg.Channel,
@@ -324,21 +741,20 @@ func (bs *bayeuxServer) HandleSubscribe(msg *messages.SubscribeRequest) {
 	}{"Welcome to " + ch.GetName() + " Client '" + client.GetId() + "'"}, ""})
 }
 
-func (bs *bayeuxServer) HandleUnsubscribe(msg *messages.SubscribeResponse) {
-	client := bs.GetClient(msg.ClientId)
+func (bs *bayeuxServer) HandleUnsubscribe(senderId string, msg *messages.SubscribeResponse) {
+	client := GetSession(bs, senderId, msg.ClientId)
 	if client == nil {
-		panic("can't publish someone whois not connected")
+		SendUnknownClient(bs, senderId, msg.Channel, msg.ClientId, msg.Id)
+		return
 	}
 
 	bs.GetLogger().Printf("Unsubscribe Message\n%v\n", msg)
 	bs.GetLogger().Printf("For Client\n%v\n", client)
 
-	bs.channelsMutex.Lock()
-	ch := bs.channels[msg.Subscription]
-	bs.channelsMutex.Unlock()
-
+	ch := bs.channels.Get(msg.Subscription)
 	if ch != nil {
 		client.Unsubscribe(ch)
+		bs.channels.Prune(msg.Subscription)
 	}
 
 	client.SendMessage(&messages.UnsubscribeResponse{
@@ -358,30 +774,83 @@ func GeneratePublicMesaageHandler(bs Server) BayeuxHandler {
 	}
 }
 
-func PublicMessage(bs Server, msg messages.RawMessage) {
-	client := bs.GetClient(msg.ClientId)
+func GenerateServiceMessageHandler(bs Server) BayeuxHandler {
+	return func(msg messages.RawMessage) {
+		ServiceMessage(bs, msg)
+	}
+}
+
+// ServiceMessage acknowledges a /service/** message that no handler was
+// registered for. It is not broadcast.
+func ServiceMessage(bs Server, msg messages.RawMessage) {
+	payload := make(map[string]interface{})
+	json.Unmarshal(msg.Payload, &payload)
+
+	Id := MessageId(msg.Payload)
+	ext, _ := payload["ext"].(map[string]interface{})
+	clientId, _ := payload["clientId"].(string)
+
+	client := GetSession(bs, msg.ClientId, clientId)
 	if client == nil {
-		panic("can't publish someone whois not connected")
+		SendUnknownClient(bs, msg.ClientId, msg.Channel, clientId, Id)
+		return
 	}
 
-	bs.GetLogger().Printf("Publish Message\n%v\n", msg)
-	bs.GetLogger().Printf("For Client\n%v\n", client)
+	if !configOf(bs).securityPolicy.CanPublish(client, msg.Channel, payload, ext) {
+		client.SendMessage(&messages.PublishResponse{
+			msg.Channel,
+			false,
+			NewError(403, "Publish Denied", msg.Channel).Error(),
+			Id,
+		})
+		return
+	}
 
+	bs.GetLogger().Printf("No Handler For Service Channel '%s'\n", msg.Channel)
+
+	client.SendMessage(&messages.PublishResponse{
+		msg.Channel,
+		true,
+		"",
+		Id,
+	})
+}
+
+func PublicMessage(bs Server, msg messages.RawMessage) {
 	payload := make(map[string]interface{})
 	json.Unmarshal(msg.Payload, &payload)
 
-	Id, ok := payload["id"]
+	Id := MessageId(msg.Payload)
+	clientId, _ := payload["clientId"].(string)
 
-	if !ok {
-		Id = interface{}("")
+	client := GetSession(bs, msg.ClientId, clientId)
+	if client == nil {
+		SendUnknownClient(bs, msg.ClientId, msg.Channel, clientId, Id)
+		return
+	}
+
+	bs.GetLogger().Printf("Publish Message\n%v\n", msg)
+	bs.GetLogger().Printf("For Client\n%v\n", client)
+
+	ext, _ := payload["ext"].(map[string]interface{})
+	if !configOf(bs).securityPolicy.CanPublish(client, msg.Channel, payload, ext) {
+		client.SendMessage(&messages.PublishResponse{
+			msg.Channel,
+			false,
+			NewError(403, "Publish Denied", msg.Channel).Error(),
+			Id,
+		})
+		return
 	}
 
 	client.SendMessage(&messages.PublishResponse{
 		msg.Channel,
 		true,
 		"",
-		Id.(string),
+		Id,
 	})
 
-	bs.Publish(msg.Channel, payload)
+	// Only the event itself is broadcast, the publisher's clientId and ext
+	// must not reach other sessions.
+	bs.Publish(msg.Channel, &messages.EventMessage{msg.Channel, payload["data"], Id})
 }
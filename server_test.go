@@ -0,0 +1,259 @@
+package bayeux
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ebittleman/go-bayeux/messages"
+)
+
+func longPollHandshake(t *testing.T, server Server, supported ...string) *messages.HandshakeResponse {
+	replies, err := server.(*bayeuxServer).HandleLongPoll([]map[string]interface{}{
+		{"channel": "/meta/handshake", "version": "1.0", "supportedConnectionTypes": supported, "id": "1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return replies[0].(*messages.HandshakeResponse)
+}
+
+func TestHandshakeNegotiatesTransports(t *testing.T) {
+	server := Handler()
+	defer server.Close()
+
+	reply := longPollHandshake(t, server, CLIENT_FLASH, CLIENT_LONGPOLL)
+	if !reply.Successful {
+		t.Fatalf("Handshake Failed %v", reply.Error)
+	}
+	if len(reply.SupportedConnectionTypes) != 1 || reply.SupportedConnectionTypes[0] != CLIENT_LONGPOLL {
+		t.Errorf("Unexpected Transports %v", reply.SupportedConnectionTypes)
+	}
+}
+
+func TestHandshakeRejectsUnsupportedTransports(t *testing.T) {
+	server := Handler(WithTransports(CLIENT_LONGPOLL))
+	defer server.Close()
+
+	reply := longPollHandshake(t, server, CLIENT_WEBSOCKET)
+	if reply.Successful {
+		t.Fatal("Handshake Should Have Failed")
+	}
+	if !strings.HasPrefix(reply.Error, "400:") {
+		t.Errorf("Unexpected Error %q", reply.Error)
+	}
+	if reply.Advice == nil || reply.Advice.Reconnect != RECONNECT_NONE {
+		t.Errorf("Unexpected Advice %v", reply.Advice)
+	}
+}
+
+func TestFailedHandshakesAreNotKept(t *testing.T) {
+	server := Handler(WithTransports(CLIENT_LONGPOLL))
+	defer server.Close()
+
+	for i := 0; i < 5; i++ {
+		if reply := longPollHandshake(t, server, CLIENT_WEBSOCKET); reply.Successful {
+			t.Fatal("Handshake Should Have Failed")
+		}
+	}
+
+	if id := firstClientId(server); id != "" {
+		t.Errorf("Failed Handshake Left Session '%s'", id)
+	}
+}
+
+func TestServiceChannelsAreNotBroadcast(t *testing.T) {
+	server := Handler()
+	defer server.Close()
+	bs := server.(*bayeuxServer)
+
+	server.HandleFunc("/service/**", func(msg messages.RawMessage) {
+		server.Deliver(msg.ClientId, &messages.EventMessage{msg.Channel, "pong", ""})
+	})
+
+	sender := longPollHandshake(t, server, CLIENT_LONGPOLL).ClientId
+	listener := longPollHandshake(t, server, CLIENT_LONGPOLL).ClientId
+
+	bs.HandleLongPoll([]map[string]interface{}{
+		{"channel": "/meta/subscribe", "clientId": listener, "subscription": "/service/echo"},
+	})
+
+	replies, _ := bs.HandleLongPoll([]map[string]interface{}{
+		{"channel": "/service/echo", "clientId": sender, "data": "ping"},
+	})
+	if len(replies) != 1 || replies[0].(*messages.EventMessage).Data != "pong" {
+		t.Errorf("Unexpected Replies %v", replies)
+	}
+
+	if server.GetChannels().Get("/service/echo") != nil {
+		t.Error("Service Channel Was Subscribed To")
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	if leaked := server.GetClient(listener).(*longPollClient).Flush(false); len(leaked) != 0 {
+		t.Errorf("Service Message Leaked To Subscriber %v", leaked)
+	}
+}
+
+func TestPublishDoesNotLeakPublisherSession(t *testing.T) {
+	server := Handler()
+	defer server.Close()
+	bs := server.(*bayeuxServer)
+
+	publisher := longPollHandshake(t, server, CLIENT_LONGPOLL).ClientId
+	subscriber := longPollHandshake(t, server, CLIENT_LONGPOLL).ClientId
+
+	bs.HandleLongPoll([]map[string]interface{}{
+		{"channel": "/meta/subscribe", "clientId": subscriber, "subscription": "/chat"},
+	})
+	server.GetClient(subscriber).(*longPollClient).Flush(false)
+
+	bs.HandleLongPoll([]map[string]interface{}{
+		{"channel": "/chat", "clientId": publisher, "data": "hi", "id": "7", "ext": authExt("secret")},
+	})
+
+	received := server.GetClient(subscriber).(*longPollClient).Flush(false)
+	if len(received) != 1 {
+		t.Fatalf("Expected One Message, got %v", received)
+	}
+
+	payload, _ := json.Marshal(received[0])
+	msg := make(map[string]interface{})
+	json.Unmarshal(payload, &msg)
+
+	if _, ok := msg["clientId"]; ok {
+		t.Errorf("Publisher's clientId Leaked To Subscriber: %s", payload)
+	}
+	if _, ok := msg["ext"]; ok {
+		t.Errorf("Publisher's ext Leaked To Subscriber: %s", payload)
+	}
+	if msg["channel"] != "/chat" || msg["data"] != "hi" || msg["id"] != "7" {
+		t.Errorf("Unexpected Message %s", payload)
+	}
+}
+
+func TestConnectUnknownClient(t *testing.T) {
+	server := Handler()
+	defer server.Close()
+
+	ws, done := dialWebSocket(t, server)
+	defer done()
+
+	ws.WriteJSON([]map[string]interface{}{
+		{"channel": "/meta/connect", "clientId": "nobody", "connectionType": CLIENT_WEBSOCKET, "id": "1"},
+	})
+
+	replies := make([]map[string]interface{}, 0)
+	if err := ws.ReadJSON(&replies); err != nil {
+		t.Fatal(err)
+	}
+	if len(replies) != 1 || replies[0]["successful"] != false || !strings.HasPrefix(replies[0]["error"].(string), "402:") {
+		t.Fatalf("Unexpected Replies %v", replies)
+	}
+	if advice, _ := replies[0]["advice"].(map[string]interface{}); advice["reconnect"] != RECONNECT_HANDSHAKE {
+		t.Errorf("Unexpected Advice %v", replies[0]["advice"])
+	}
+}
+
+func TestInvalidSubscriptionsAreRejected(t *testing.T) {
+	server := Handler()
+	defer server.Close()
+	bs := server.(*bayeuxServer)
+
+	clientId := longPollHandshake(t, server, CLIENT_LONGPOLL).ClientId
+	for _, subscription := range []string{"", "foo", "/foo//bar", "/foo/"} {
+		replies, _ := bs.HandleLongPoll([]map[string]interface{}{
+			{"channel": "/meta/subscribe", "clientId": clientId, "subscription": subscription},
+		})
+
+		if len(replies) != 1 {
+			t.Fatalf("%q: Unexpected Replies %v", subscription, replies)
+		}
+		reply := replies[0].(*messages.SubscribeResponse)
+		if reply.Successful || !strings.HasPrefix(reply.Error, "400:") {
+			t.Errorf("%q: Unexpected Reply %+v", subscription, reply)
+		}
+	}
+
+	if server.GetChannels().Len() != 0 {
+		t.Error("Channel Created For Invalid Subscription")
+	}
+}
+
+// benchmarkSubscribers sets up long-poll sessions subscribed to
+// /stocks/AAPL with the ack and timesync extensions active, as in the
+// example server.
+func benchmarkSubscribers(b *testing.B, subscribers int) (Server, []*longPollClient) {
+	server := Handler(
+		WithLogger(log.New(ioutil.Discard, "", 0)),
+		WithExtension(NewAckExtension()),
+		WithExtension(NewTimesyncExtension()),
+		WithQueueLimit(0, OVERFLOW_DROP_OLDEST),
+	)
+	bs := server.(*bayeuxServer)
+
+	ext := map[string]interface{}{"ack": true, "timesync": map[string]interface{}{"tc": 0, "l": 0, "o": 0}}
+	clients := make([]*longPollClient, 0, subscribers)
+	for i := 0; i < subscribers; i++ {
+		replies, _ := bs.HandleLongPoll([]map[string]interface{}{
+			{"channel": "/meta/handshake", "version": "1.0", "supportedConnectionTypes": []string{CLIENT_LONGPOLL}, "ext": ext},
+		})
+		clientId, _ := replies[0].(map[string]interface{})["clientId"].(string)
+		bs.HandleLongPoll([]map[string]interface{}{
+			{"channel": "/meta/subscribe", "clientId": clientId, "subscription": "/stocks/AAPL"},
+		})
+
+		client := server.GetClient(clientId).(*longPollClient)
+		client.Flush(false)
+		clients = append(clients, client)
+	}
+
+	return server, clients
+}
+
+// BenchmarkPublish compares the broadcast path, which encodes a message once
+// for every subscriber, with handing each session the message to encode
+// itself as broadcasts used to. Both go through SendMessage, the extensions
+// and the frame encoding of the streaming transports.
+func BenchmarkPublish(b *testing.B) {
+	msg := map[string]interface{}{
+		"channel": "/stocks/AAPL",
+		"data":    map[string]interface{}{"symbol": "AAPL", "bid": 187.31, "ask": 187.33, "volume": 51234},
+	}
+
+	drain := func(clients []*longPollClient) {
+		for _, client := range clients {
+			client.nextBatch(nil)
+		}
+	}
+
+	b.Run("EncodeOnce", func(b *testing.B) {
+		server, clients := benchmarkSubscribers(b, 1000)
+		defer server.Close()
+		b.ReportAllocs()
+		b.ResetTimer()
+
+		for i := 0; i < b.N; i++ {
+			server.Publish("/stocks/AAPL", msg)
+			drain(clients)
+		}
+	})
+
+	b.Run("EncodePerSession", func(b *testing.B) {
+		server, clients := benchmarkSubscribers(b, 1000)
+		defer server.Close()
+		b.ReportAllocs()
+		b.ResetTimer()
+
+		for i := 0; i < b.N; i++ {
+			for _, client := range clients {
+				client.SendMessage(msg)
+			}
+			drain(clients)
+		}
+	})
+}
@@ -0,0 +1,76 @@
+package bayeux
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/ebittleman/go-bayeux/channel"
+	"github.com/ebittleman/go-bayeux/messages"
+)
+
+// ServiceFunc answers a /service/** request. The returned value is sent back
+// to the calling client as the reply's data, correlated by the message id.
+type ServiceFunc func(Client, *messages.ServiceRequest) (interface{}, error)
+
+// HandleService registers fn as the request/response handler for a service
+// channel. Wildcards such as "/service/users/**" are allowed.
+func HandleService(bs Server, channelName string, fn ServiceFunc) error {
+	if !channel.IsService(channelName) {
+		return fmt.Errorf("'%s' is not a service channel", channelName)
+	}
+
+	bs.HandleFunc(channelName, GenerateServiceHandler(bs, fn))
+	return nil
+}
+
+func GenerateServiceHandler(bs Server, fn ServiceFunc) BayeuxHandler {
+	return func(msg messages.RawMessage) {
+		ServiceCall(bs, msg, fn)
+	}
+}
+
+func ServiceCall(bs Server, msg messages.RawMessage, fn ServiceFunc) {
+	request := &messages.ServiceRequest{}
+	err := json.Unmarshal(msg.Payload, request)
+	if err != nil {
+		SendError(bs, msg.ClientId, msg.Channel, MessageId(msg.Payload), NewError(400, err.Error()), nil)
+		return
+	}
+
+	client := GetSession(bs, msg.ClientId, request.ClientId)
+	if client == nil {
+		SendUnknownClient(bs, msg.ClientId, msg.Channel, request.ClientId, request.Id)
+		return
+	}
+
+	if !configOf(bs).securityPolicy.CanPublish(client, request.Channel, request, request.Ext) {
+		client.SendMessage(&messages.ServiceResponse{
+			request.Channel,
+			false,
+			NewError(403, "Publish Denied", request.Channel).Error(),
+			nil,
+			request.Id,
+		})
+		return
+	}
+
+	data, err := fn(client, request)
+	if err != nil {
+		client.SendMessage(&messages.ServiceResponse{
+			request.Channel,
+			false,
+			NewError(500, err.Error()).Error(),
+			nil,
+			request.Id,
+		})
+		return
+	}
+
+	client.SendMessage(&messages.ServiceResponse{
+		request.Channel,
+		true,
+		"",
+		data,
+		request.Id,
+	})
+}
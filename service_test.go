@@ -0,0 +1,65 @@
+package bayeux
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ebittleman/go-bayeux/messages"
+)
+
+func TestHandleService(t *testing.T) {
+	server := Handler()
+	defer server.Close()
+	bs := server.(*bayeuxServer)
+
+	err := HandleService(server, "/service/add", func(client Client, req *messages.ServiceRequest) (interface{}, error) {
+		operands := []int{}
+		if err := req.Decode(&operands); err != nil {
+			return nil, err
+		}
+		if len(operands) == 0 {
+			return nil, errors.New("nothing to add")
+		}
+
+		sum := 0
+		for _, operand := range operands {
+			sum += operand
+		}
+		return sum, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clientId := longPollHandshake(t, server, CLIENT_LONGPOLL).ClientId
+
+	replies, _ := bs.HandleLongPoll([]map[string]interface{}{
+		{"channel": "/service/add", "clientId": clientId, "id": "7", "data": []int{1, 2, 3}},
+		{"channel": "/service/add", "clientId": clientId, "id": "8", "data": []int{}},
+	})
+	if len(replies) != 2 {
+		t.Fatalf("Unexpected Replies %v", replies)
+	}
+
+	reply := replies[0].(*messages.ServiceResponse)
+	if !reply.Successful || reply.Id != "7" || reply.Data != 6 {
+		t.Errorf("Unexpected Reply %v", reply)
+	}
+
+	reply = replies[1].(*messages.ServiceResponse)
+	if reply.Successful || reply.Id != "8" || reply.Error != "500::nothing to add" {
+		t.Errorf("Unexpected Reply %v", reply)
+	}
+}
+
+func TestHandleServiceRejectsBroadcastChannels(t *testing.T) {
+	server := Handler()
+	defer server.Close()
+
+	err := HandleService(server, "/chat", func(Client, *messages.ServiceRequest) (interface{}, error) {
+		return nil, nil
+	})
+	if err == nil {
+		t.Error("Expected An Error")
+	}
+}
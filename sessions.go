@@ -0,0 +1,69 @@
+package bayeux
+
+import (
+	"time"
+)
+
+// SessionListener is notified when a client is removed from the server.
+// timedOut is set when the client was reaped for not connecting within the
+// advised maxInterval.
+type SessionListener func(client Client, timedOut bool)
+
+// addSessionListener registers l for client removals.
+func (bs *bayeuxServer) addSessionListener(l SessionListener) {
+	bs.sessionListeners = append(bs.sessionListeners, l)
+}
+
+func (bs *bayeuxServer) removeClient(id string, timedOut bool) {
+	bs.clientMutex.Lock()
+	client, ok := bs.clients[id]
+	delete(bs.clients, id)
+	bs.clientMutex.Unlock()
+
+	if !ok {
+		return
+	}
+
+	for _, l := range bs.sessionListeners {
+		l(client, timedOut)
+	}
+}
+
+// Sweep removes every client that has not connected within expiry, closing
+// it so that it is unsubscribed from all of its channels.
+func (bs *bayeuxServer) Sweep(expiry time.Duration) {
+	expired := make([]Client, 0)
+
+	bs.clientMutex.Lock()
+	for _, client := range bs.clients {
+		if time.Since(client.GetLastSeen()) > expiry {
+			expired = append(expired, client)
+		}
+	}
+	bs.clientMutex.Unlock()
+
+	for _, client := range expired {
+		bs.GetLogger().Printf("Session Expired '%s'\n", client.GetId())
+		bs.removeClient(client.GetId(), true)
+		client.Close()
+	}
+}
+
+// SweepLoop reaps clients that have gone longer than the connect timeout
+// plus the advised maxInterval without a /meta/connect.
+func (bs *bayeuxServer) SweepLoop() {
+	maxInterval := time.Duration(bs.maxInterval) * time.Millisecond
+	expiry := time.Duration(bs.timeout)*time.Millisecond + maxInterval
+
+	ticker := time.NewTicker(maxInterval / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			bs.Sweep(expiry)
+		case <-bs.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package bayeux
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSweepReapsIdleClients(t *testing.T) {
+	server := Handler()
+	defer server.Close()
+	bs := server.(*bayeuxServer)
+
+	var (
+		lock    sync.Mutex
+		removed = make(map[string]bool)
+	)
+	bs.addSessionListener(func(client Client, timedOut bool) {
+		lock.Lock()
+		removed[client.GetId()] = timedOut
+		lock.Unlock()
+	})
+
+	idle := longPollHandshake(t, server, CLIENT_LONGPOLL).ClientId
+	bs.HandleLongPoll([]map[string]interface{}{
+		{"channel": "/meta/subscribe", "clientId": idle, "subscription": "/stocks/AAPL"},
+	})
+
+	time.Sleep(20 * time.Millisecond)
+	active := longPollHandshake(t, server, CLIENT_LONGPOLL).ClientId
+
+	bs.Sweep(10 * time.Millisecond)
+
+	if server.GetClient(idle) != nil {
+		t.Error("Idle Client Was Not Reaped")
+	}
+	if server.GetClient(active) == nil {
+		t.Error("Active Client Was Reaped")
+	}
+	if server.GetChannels().Get("/stocks/AAPL") != nil {
+		t.Error("Reaped Client Was Not Unsubscribed")
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	if timedOut, ok := removed[idle]; !ok || !timedOut {
+		t.Errorf("Removal Event Not Fired %v", removed)
+	}
+}
@@ -0,0 +1,113 @@
+package bayeux
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ebittleman/go-bayeux/channel"
+	"github.com/ebittleman/go-bayeux/messages"
+)
+
+type timesyncExtension struct{}
+
+type timesyncSample struct {
+	tc interface{}
+	ts int64
+}
+
+type timesyncSession struct {
+	pending map[string]timesyncSample
+	lock    *sync.Mutex
+}
+
+// NewTimesyncExtension implements the server side of the timesync
+// extension. Meta messages carrying {"ext": {"timesync": {"tc": ...}}} are
+// answered with the client's tc, the server receive time ts and the time p
+// spent on the server, from which clients work out their clock offset and
+// network lag.
+func NewTimesyncExtension() ServerExtension {
+	return &timesyncExtension{}
+}
+
+func (e *timesyncExtension) Incoming(client Client, msg map[string]interface{}) bool {
+	if msg["channel"] != "/meta/handshake" {
+		return true
+	}
+
+	session := newTimesyncSession()
+	if session.receive(msg) {
+		client.AddExtension(session)
+	}
+
+	return true
+}
+
+func (e *timesyncExtension) Outgoing(client Client, msg map[string]interface{}) bool {
+	return true
+}
+
+func (e *timesyncExtension) OutgoingEncoded(client Client, msg messages.Encoded) bool {
+	return true
+}
+
+func newTimesyncSession() *timesyncSession {
+	return &timesyncSession{make(map[string]timesyncSample), &sync.Mutex{}}
+}
+
+func millis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+// receive records when a meta message carrying timesync arrived, until its
+// reply goes out.
+func (s *timesyncSession) receive(msg map[string]interface{}) bool {
+	name, _ := msg["channel"].(string)
+	ext, _ := msg["ext"].(map[string]interface{})
+	timesync, _ := ext["timesync"].(map[string]interface{})
+	if !channel.IsMeta(name) || timesync == nil {
+		return false
+	}
+
+	s.lock.Lock()
+	s.pending[name] = timesyncSample{timesync["tc"], millis(time.Now())}
+	s.lock.Unlock()
+
+	return true
+}
+
+func (s *timesyncSession) Incoming(client Client, msg map[string]interface{}) bool {
+	s.receive(msg)
+	return true
+}
+
+// OutgoingEncoded passes broadcasts through, only meta replies carry
+// timesync.
+func (s *timesyncSession) OutgoingEncoded(client Client, msg messages.Encoded) bool {
+	return true
+}
+
+func (s *timesyncSession) Outgoing(client Client, msg map[string]interface{}) bool {
+	name, _ := msg["channel"].(string)
+
+	s.lock.Lock()
+	sample, ok := s.pending[name]
+	delete(s.pending, name)
+	s.lock.Unlock()
+
+	if !ok {
+		return true
+	}
+
+	ext, _ := msg["ext"].(map[string]interface{})
+	if ext == nil {
+		ext = make(map[string]interface{})
+		msg["ext"] = ext
+	}
+	ext["timesync"] = map[string]interface{}{
+		"tc": sample.tc,
+		"ts": sample.ts,
+		"p":  millis(time.Now()) - sample.ts,
+	}
+
+	return true
+}
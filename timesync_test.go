@@ -0,0 +1,49 @@
+package bayeux
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimesyncExtensionEchoesTimestamps(t *testing.T) {
+	server := Handler(WithExtension(NewTimesyncExtension()))
+	defer server.Close()
+
+	timesync := func(tc int64) map[string]interface{} {
+		return map[string]interface{}{"timesync": map[string]interface{}{"tc": tc, "l": 0, "o": 0}}
+	}
+
+	before := millis(time.Now())
+	replies := postMessages(t, server, []map[string]interface{}{
+		{"channel": "/meta/handshake", "version": "1.0", "supportedConnectionTypes": []string{CLIENT_LONGPOLL}, "ext": timesync(42)},
+	})
+	clientId, _ := replies[0]["clientId"].(string)
+
+	check := func(reply map[string]interface{}, tc float64) {
+		ext, _ := reply["ext"].(map[string]interface{})
+		sample, _ := ext["timesync"].(map[string]interface{})
+		if sample["tc"] != tc {
+			t.Errorf("Client Time Not Echoed: %v", reply)
+		}
+		if ts, _ := sample["ts"].(float64); int64(ts) < before {
+			t.Errorf("Bad Receive Time: %v", reply)
+		}
+		if p, ok := sample["p"].(float64); !ok || p < 0 {
+			t.Errorf("Bad Processing Time: %v", reply)
+		}
+	}
+
+	check(replies[0], 42)
+
+	replies = postMessages(t, server, []map[string]interface{}{
+		{"channel": "/meta/connect", "clientId": clientId, "connectionType": CLIENT_LONGPOLL, "ext": timesync(43)},
+	})
+	check(replies[0], 43)
+
+	replies = postMessages(t, server, []map[string]interface{}{
+		{"channel": "/meta/subscribe", "clientId": clientId, "subscription": "/prices"},
+	})
+	if _, ok := replies[0]["ext"]; ok {
+		t.Errorf("Timesync Sent Without Request: %v", replies)
+	}
+}
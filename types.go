@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -17,10 +19,14 @@ const (
 	CLIENT_CALLBACK  = "callback-polling"
 	CLIENT_IFRAME    = "iframe"
 	CLIENT_FLASH     = "flash"
+	CLIENT_SSE       = "eventsource"
 
 	RECONNECT_RETRY     = "retry"
 	RECONNECT_HANDSHAKE = "handshake"
 	RECONNECT_NONE      = "none"
+
+	BAYEUX_VERSION         = "1.0"
+	BAYEUX_MINIMUM_VERSION = "1.0"
 )
 
 var logger *log.Logger
@@ -33,16 +39,21 @@ func init() {
 	logger = log.New(os.Stdout, "go-bayux/client::", log.Ldate|log.Ltime)
 }
 
-var supportedClients = []string{CLIENT_WEBSOCKET}
-var defaultInterval = 60000
+var supportedClients = []string{CLIENT_WEBSOCKET, CLIENT_SSE, CLIENT_LONGPOLL, CLIENT_CALLBACK}
+var defaultInterval = 0
+var defaultTimeout = 30000
+var defaultMaxInterval = 10000
+var defaultViolationLimit = 0
+var defaultResumeGrace = time.Duration(0)
+var defaultQueueLimit = 1000
+var defaultOverflowPolicy = OVERFLOW_DROP_OLDEST
+var defaultBatchWindow = time.Duration(0)
+var defaultMaxBatchSize = 100
+var defaultMaxBatchBytes = 64 * 1024
 
 type Event interface{}
 type Envelope interface{}
 
-type ChannelSegment interface {
-	GetToken() string
-}
-type ChanelSegments []ChannelSegment
 type Connection interface{}
 
 type Timestamp struct {
@@ -59,3 +70,45 @@ func (t *Timestamp) String() string {
 
 	return fmt.Sprintf("%s.%d", utc.Format("2006-01-02T15:04:05"), pre)
 }
+
+// CompareVersions compares two dotted Bayeux version strings, returning -1, 0
+// or 1. Missing or non numeric parts compare as zero.
+func CompareVersions(a, b string) int {
+	as := strings.Split(a, ".")
+	bs := strings.Split(b, ".")
+
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+
+		if x < y {
+			return -1
+		}
+		if x > y {
+			return 1
+		}
+	}
+
+	return 0
+}
+
+// NegotiateTransports returns the connection types found in both lists, in
+// the server's order of preference.
+func NegotiateTransports(server, client []string) []string {
+	types := make([]string, 0, len(server))
+	for _, s := range server {
+		for _, c := range client {
+			if s == c {
+				types = append(types, s)
+				break
+			}
+		}
+	}
+
+	return types
+}
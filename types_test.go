@@ -0,0 +1,39 @@
+package bayeux
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCompareVersions(t *testing.T) {
+	cases := []struct {
+		a, b     string
+		expected int
+	}{
+		{"1.0", "1.0", 0},
+		{"1.0", "1", 0},
+		{"0.9", "1.0", -1},
+		{"1.0.1", "1.0", 1},
+		{"2.0", "10.0", -1},
+	}
+
+	for _, c := range cases {
+		if actual := CompareVersions(c.a, c.b); actual != c.expected {
+			t.Errorf("CompareVersions(%q, %q) = %d, expected %d", c.a, c.b, actual, c.expected)
+		}
+	}
+}
+
+func TestNegotiateTransports(t *testing.T) {
+	server := []string{CLIENT_WEBSOCKET, CLIENT_LONGPOLL}
+
+	actual := NegotiateTransports(server, []string{CLIENT_CALLBACK, CLIENT_LONGPOLL, CLIENT_WEBSOCKET})
+	if !reflect.DeepEqual(actual, server) {
+		t.Errorf("Unexpected Transports %v", actual)
+	}
+
+	actual = NegotiateTransports(server, []string{CLIENT_CALLBACK})
+	if len(actual) != 0 {
+		t.Errorf("Unexpected Transports %v", actual)
+	}
+}
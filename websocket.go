@@ -0,0 +1,176 @@
+package bayeux
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	CLOSE_NORMAL           = websocket.CloseNormalClosure
+	CLOSE_GOING_AWAY       = websocket.CloseGoingAway
+	CLOSE_PROTOCOL_ERROR   = websocket.CloseProtocolError
+	CLOSE_POLICY_VIOLATION = websocket.ClosePolicyViolation
+	CLOSE_MESSAGE_TOO_BIG  = websocket.CloseMessageTooBig
+)
+
+// WebSocketConn is the connection a websocketClient exchanges message
+// batches over. Close may be called concurrently with the other methods.
+type WebSocketConn interface {
+	ReadJSON(interface{}) error
+	WriteFrame([]byte) error
+	Close(code int, reason string) error
+}
+
+// WebSocketUpgrader turns an HTTP request into a WebSocketConn.
+type WebSocketUpgrader interface {
+	Upgrade(http.ResponseWriter, *http.Request) (WebSocketConn, error)
+}
+
+type WebSocketOptions struct {
+	// PingInterval is how often a ping is sent to keep the connection
+	// alive. Zero disables pings.
+	PingInterval time.Duration
+	// ReadTimeout is how long to wait for a message or pong before the
+	// connection is considered dead. Zero disables the read deadline.
+	ReadTimeout time.Duration
+	// WriteTimeout bounds each frame write. Zero disables the deadline.
+	WriteTimeout time.Duration
+	// MaxFrameSize is the largest message accepted from a client. Larger
+	// messages close the connection with CLOSE_MESSAGE_TOO_BIG.
+	MaxFrameSize int64
+	// CheckOrigin validates the Origin header, by default only same origin
+	// requests are accepted.
+	CheckOrigin func(*http.Request) bool
+	// EnableCompression negotiates permessage-deflate with clients that
+	// offer it.
+	EnableCompression bool
+	// CompressionLevel is a compress/flate level between -2 and 9.
+	CompressionLevel int
+	// CompressionThreshold is the smallest payload, in bytes, that is sent
+	// compressed. Smaller frames are not worth the deflate overhead.
+	CompressionThreshold int
+}
+
+var DefaultWebSocketOptions = WebSocketOptions{
+	PingInterval: 25 * time.Second,
+	ReadTimeout:  60 * time.Second,
+	WriteTimeout: 10 * time.Second,
+	MaxFrameSize: 64 * 1024,
+
+	CompressionLevel:     1,
+	CompressionThreshold: 1024,
+}
+
+type gorillaUpgrader struct {
+	upgrader *websocket.Upgrader
+	opts     WebSocketOptions
+}
+
+type gorillaConn struct {
+	conn      *websocket.Conn
+	opts      WebSocketOptions
+	done      chan struct{}
+	closeOnce *sync.Once
+}
+
+func NewWebSocketUpgrader(opts WebSocketOptions) WebSocketUpgrader {
+	return &gorillaUpgrader{
+		&websocket.Upgrader{
+			CheckOrigin:       opts.CheckOrigin,
+			EnableCompression: opts.EnableCompression,
+		},
+		opts,
+	}
+}
+
+func (u *gorillaUpgrader) Upgrade(w http.ResponseWriter, r *http.Request) (WebSocketConn, error) {
+	ws, err := u.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	conn := &gorillaConn{ws, u.opts, make(chan struct{}), &sync.Once{}}
+
+	if u.opts.EnableCompression {
+		if err := ws.SetCompressionLevel(u.opts.CompressionLevel); err != nil {
+			ws.Close()
+			return nil, err
+		}
+	}
+
+	if u.opts.MaxFrameSize > 0 {
+		ws.SetReadLimit(u.opts.MaxFrameSize)
+	}
+
+	ws.SetPongHandler(func(string) error {
+		conn.extendReadDeadline()
+		return nil
+	})
+
+	if u.opts.PingInterval > 0 {
+		go conn.PingLoop()
+	}
+
+	return conn, nil
+}
+
+func (c *gorillaConn) extendReadDeadline() {
+	if c.opts.ReadTimeout > 0 {
+		c.conn.SetReadDeadline(time.Now().Add(c.opts.ReadTimeout))
+	}
+}
+
+func (c *gorillaConn) writeDeadline() time.Time {
+	if c.opts.WriteTimeout > 0 {
+		return time.Now().Add(c.opts.WriteTimeout)
+	}
+
+	return time.Time{}
+}
+
+func (c *gorillaConn) ReadJSON(v interface{}) error {
+	c.extendReadDeadline()
+	return c.conn.ReadJSON(v)
+}
+
+// WriteFrame writes payload, which must already be JSON, as a text frame.
+func (c *gorillaConn) WriteFrame(payload []byte) error {
+	// A no-op unless permessage-deflate was negotiated.
+	c.conn.EnableWriteCompression(len(payload) >= c.opts.CompressionThreshold)
+
+	c.conn.SetWriteDeadline(c.writeDeadline())
+	return c.conn.WriteMessage(websocket.TextMessage, payload)
+}
+
+func (c *gorillaConn) PingLoop() {
+	ticker := time.NewTicker(c.opts.PingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			err := c.conn.WriteControl(websocket.PingMessage, nil, c.writeDeadline())
+			if err != nil {
+				c.Close(CLOSE_GOING_AWAY, "")
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+func (c *gorillaConn) Close(code int, reason string) error {
+	var err error
+
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), c.writeDeadline())
+		err = c.conn.Close()
+	})
+
+	return err
+}
@@ -0,0 +1,178 @@
+package bayeux
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func dialWebSocket(t *testing.T, server Server) (*websocket.Conn, func()) {
+	ts := httptest.NewServer(server)
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http"), nil)
+	if err != nil {
+		ts.Close()
+		t.Fatal(err)
+	}
+
+	return ws, func() {
+		ws.Close()
+		ts.Close()
+	}
+}
+
+func TestWebSocketHandshake(t *testing.T) {
+	server := Handler()
+	defer server.Close()
+
+	ws, done := dialWebSocket(t, server)
+	defer done()
+
+	err := ws.WriteJSON([]map[string]interface{}{
+		{"channel": "/meta/handshake", "version": "1.0", "supportedConnectionTypes": []string{CLIENT_WEBSOCKET}, "id": "1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	replies := make([]map[string]interface{}, 0)
+	if err := ws.ReadJSON(&replies); err != nil {
+		t.Fatal(err)
+	}
+	if len(replies) != 1 || replies[0]["successful"] != true {
+		t.Errorf("Unexpected Replies %v", replies)
+	}
+}
+
+func TestWebSocketDisconnectIsAnswered(t *testing.T) {
+	server := Handler()
+	defer server.Close()
+
+	ws, done := dialWebSocket(t, server)
+	defer done()
+
+	ws.WriteJSON([]map[string]interface{}{
+		{"channel": "/meta/handshake", "version": "1.0", "supportedConnectionTypes": []string{CLIENT_WEBSOCKET}},
+	})
+	replies := make([]map[string]interface{}, 0)
+	if err := ws.ReadJSON(&replies); err != nil {
+		t.Fatal(err)
+	}
+	clientId, _ := replies[0]["clientId"].(string)
+
+	ws.WriteJSON([]map[string]interface{}{
+		{"channel": "/meta/disconnect", "clientId": clientId, "id": "2"},
+	})
+	if err := ws.ReadJSON(&replies); err != nil {
+		t.Fatalf("Disconnect Reply Not Received: %s", err)
+	}
+	if len(replies) != 1 || replies[0]["channel"] != "/meta/disconnect" || replies[0]["successful"] != true {
+		t.Errorf("Unexpected Replies %v", replies)
+	}
+	if _, _, err := ws.ReadMessage(); !websocket.IsCloseError(err, CLOSE_NORMAL) {
+		t.Errorf("Expected Normal Close, got %v", err)
+	}
+	if server.GetClient(clientId) != nil {
+		t.Error("Session Was Not Closed")
+	}
+}
+
+func TestWebSocketMaxFrameSize(t *testing.T) {
+	opts := DefaultWebSocketOptions
+	opts.MaxFrameSize = 16
+
+	server := Handler(WithWebSocketOptions(opts))
+	defer server.Close()
+
+	ws, done := dialWebSocket(t, server)
+	defer done()
+
+	ws.WriteJSON([]map[string]interface{}{{"channel": "/meta/handshake", "version": "1.0"}})
+
+	_, _, err := ws.ReadMessage()
+	if !websocket.IsCloseError(err, CLOSE_MESSAGE_TOO_BIG) {
+		t.Errorf("Unexpected Error %v", err)
+	}
+}
+
+func TestWebSocketCompression(t *testing.T) {
+	opts := DefaultWebSocketOptions
+	opts.EnableCompression = true
+
+	server := Handler(WithWebSocketOptions(opts))
+	defer server.Close()
+
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	dialer := &websocket.Dialer{EnableCompression: true}
+	ws, resp, err := dialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	if !strings.Contains(resp.Header.Get("Sec-WebSocket-Extensions"), "permessage-deflate") {
+		t.Fatalf("Compression Was Not Negotiated %v", resp.Header)
+	}
+
+	err = ws.WriteJSON([]map[string]interface{}{
+		{"channel": "/meta/handshake", "version": "1.0", "supportedConnectionTypes": []string{CLIENT_WEBSOCKET}, "id": strings.Repeat("1", 2048)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	replies := make([]map[string]interface{}, 0)
+	if err := ws.ReadJSON(&replies); err != nil {
+		t.Fatal(err)
+	}
+	if len(replies) != 1 || replies[0]["successful"] != true {
+		t.Errorf("Unexpected Replies %v", replies)
+	}
+}
+
+func TestWebSocketBatchIsProcessedInOrder(t *testing.T) {
+	server := Handler()
+	defer server.Close()
+
+	ws, done := dialWebSocket(t, server)
+	defer done()
+
+	ws.WriteJSON([]map[string]interface{}{
+		{"channel": "/meta/handshake", "version": "1.0", "supportedConnectionTypes": []string{CLIENT_WEBSOCKET}},
+	})
+	handshake, _ := readUntil(t, ws, "/meta/handshake")
+	clientId, _ := handshake["clientId"].(string)
+
+	// The publish only reaches this client if the subscribe before it in the
+	// same frame has been processed.
+	ws.WriteJSON([]map[string]interface{}{
+		{"channel": "/meta/subscribe", "clientId": clientId, "subscription": "/orders"},
+		{"channel": "/orders", "clientId": clientId, "data": "filled", "id": "2"},
+	})
+
+	ws.SetReadDeadline(time.Now().Add(time.Second))
+	order := make([]string, 0)
+	for {
+		replies := make([]map[string]interface{}, 0)
+		if err := ws.ReadJSON(&replies); err != nil {
+			t.Fatalf("Published Message Not Delivered, got %v: %s", order, err)
+		}
+		for _, reply := range replies {
+			name, _ := reply["channel"].(string)
+			if _, ok := reply["successful"]; ok {
+				order = append(order, name)
+			}
+			if name == "/orders" && reply["data"] == "filled" {
+				if len(order) == 0 || order[0] != "/meta/subscribe" {
+					t.Errorf("Replies Out Of Order: %v", order)
+				}
+				return
+			}
+		}
+	}
+}